@@ -0,0 +1,42 @@
+package bfmdrenderer
+
+import (
+	"bytes"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// alertTypes are the types of the GFM alerts
+var alertTypes = []string{"NOTE", "TIP", "IMPORTANT", "WARNING", "CAUTION"}
+
+// splitAlertMarker splits the GFM alert marker ([!NOTE]) opening a
+// blockquote from the rest of text, node being the first text of the quote.
+// The marker has to stand on its own line.
+func splitAlertMarker(node *bf.Node, text []byte) (marker []byte, rest []byte, ok bool) {
+	paragraph := node.Parent
+	if node.Prev != nil || paragraph == nil || paragraph.Type != bf.Paragraph ||
+		paragraph.Prev != nil || paragraph.Parent == nil || paragraph.Parent.Type != bf.BlockQuote {
+		return nil, nil, false
+	}
+
+	end := bytes.IndexByte(text, ']')
+	if !bytes.HasPrefix(text, []byte("[!")) || end < 0 {
+		return nil, nil, false
+	}
+	known := false
+	for _, alertType := range alertTypes {
+		known = known || bytes.EqualFold(text[2:end], []byte(alertType))
+	}
+	if !known {
+		return nil, nil, false
+	}
+
+	marker, rest = text[:end+1], bytes.TrimLeft(text[end+1:], " \t")
+	switch {
+	case len(rest) > 0 && rest[0] == '\n':
+		return marker, rest[1:], true
+	case len(rest) == 0 && (node.Next == nil || node.Next.Type == bf.Softbreak):
+		return marker, rest, true
+	}
+	return nil, nil, false
+}
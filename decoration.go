@@ -0,0 +1,22 @@
+package bfmdrenderer
+
+// decoration is a stack of line prefixes (quote markers, list indentation).
+// All levels share a single backing array and the length before each push is
+// recorded, so that leaving a level is a mere reslice.
+type decoration struct {
+	bytes   []byte
+	lengths []int
+}
+
+// push adds a level of decoration
+func (d *decoration) push(prefix ...byte) {
+	d.lengths = append(d.lengths, len(d.bytes))
+	d.bytes = append(d.bytes, prefix...)
+}
+
+// pop removes the last level of decoration
+func (d *decoration) pop() {
+	last := len(d.lengths) - 1
+	d.bytes = d.bytes[:d.lengths[last]]
+	d.lengths = d.lengths[:last]
+}
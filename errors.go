@@ -0,0 +1,26 @@
+package bfmdrenderer
+
+import (
+	"fmt"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// UnsupportedNodeError reports a node the renderer cannot represent in
+// Markdown. Blackfriday nodes carry no source position, hence no line number.
+type UnsupportedNodeError struct {
+	Type bf.NodeType
+}
+
+func (e *UnsupportedNodeError) Error() string {
+	if !knownNodeType(e.Type) {
+		return fmt.Sprintf("Unknown BlackFriday Node type %d", int(e.Type))
+	}
+	return fmt.Sprintf("Unknown BlackFriday Node type '%s'", e.Type)
+}
+
+// knownNodeType tells if t is one of the node types of Blackfriday, whose
+// NodeType.String panics on the others
+func knownNodeType(t bf.NodeType) bool {
+	return t >= bf.Document && t <= bf.TableRow
+}
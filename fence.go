@@ -0,0 +1,97 @@
+package bfmdrenderer
+
+import "bytes"
+
+// fenceRun returns the length of the longest run of c opening a line of
+// code, which would close a fence made of c
+func fenceRun(code []byte, c byte) int {
+	longest := 0
+	for _, line := range bytes.Split(code, []byte("\n")) {
+		line = bytes.TrimLeft(line, " ")
+		run := 0
+		for run < len(line) && line[run] == c {
+			run++
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
+
+// codeFence returns a fence that the code it encloses cannot close. Backtick
+// fences are used unless the info string holds a backtick, which CommonMark
+// forbids, or the code holds backtick fences itself. The info string is
+// written as is after either kind of fence.
+func codeFence(info []byte, code []byte) []byte {
+	c := byte('`')
+	if bytes.IndexByte(info, '`') >= 0 || fenceRun(code, '`') >= 3 {
+		c = '~'
+	}
+	length := 3
+	if run := fenceRun(code, c); run >= length {
+		length = run + 1
+	}
+	return bytes.Repeat([]byte{c}, length)
+}
+
+// expandTabs replaces the tabs of code by spaces, up to the next multiple
+// of width on each line
+func expandTabs(code []byte, width int) []byte {
+	if bytes.IndexByte(code, '\t') < 0 {
+		return code
+	}
+	out := make([]byte, 0, len(code))
+	column := 0
+	for _, c := range code {
+		switch c {
+		case '\t':
+			spaces := width - column%width
+			out = append(out, bytes.Repeat([]byte(" "), spaces)...)
+			column += spaces
+		case '\n':
+			out = append(out, c)
+			column = 0
+		default:
+			out = append(out, c)
+			// Continuation bytes of UTF-8 sequences take no column
+			if c&0xC0 != 0x80 {
+				column++
+			}
+		}
+	}
+	return out
+}
+
+// trimTrailingSpaces strips the trailing spaces and tabs of every line of code
+func trimTrailingSpaces(code []byte) []byte {
+	lines := bytes.Split(code, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimRight(line, " \t")
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// codeSpanDelimiter returns the backtick run delimiting a code span, at least
+// minimum backticks long and longer than any run of backticks within code,
+// and tells whether code needs to be padded with spaces: CommonMark strips one
+// space on each side of a code span.
+func codeSpanDelimiter(code []byte, minimum int) ([]byte, bool) {
+	longest, run := 0, 0
+	for _, c := range code {
+		if c == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	pad := len(code) > 0 && (code[0] == '`' || code[len(code)-1] == '`' ||
+		code[0] == ' ' && code[len(code)-1] == ' ' && len(bytes.Trim(code, " ")) > 0)
+	if longest+1 > minimum {
+		minimum = longest + 1
+	}
+	return bytes.Repeat([]byte("`"), minimum), pad
+}
@@ -0,0 +1,65 @@
+package bfmdrenderer
+
+import (
+	"bytes"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// footnoteIndent is the indentation of the continuation blocks of a footnote
+// definition
+const footnoteIndent = 4
+
+// footnoteMarker returns the marker of a footnote reference or definition,
+// [^label], from the label blackfriday stores in the destination of references
+// and in the RefLink of definitions
+func footnoteMarker(label []byte) []byte {
+	marker := make([]byte, 0, len(label)+3)
+	marker = append(marker, "[^"...)
+	marker = append(marker, label...)
+	return append(marker, ']')
+}
+
+// isFootnoteBackReference tells if a node is part of the back-reference link
+// (<a class="footnote-return">↩</a>) HTML renderers append to footnote
+// definitions, held by one HTML span or split into spans and text. It has no
+// place in Markdown, where the renderer of the output adds its own.
+func isFootnoteBackReference(node *bf.Node) bool {
+	if !inFootnote(node) {
+		return false
+	}
+	// The opening tag is at most two siblings back: <a ...>, ↩, </a>
+	for n, i := node, 0; n != nil && i < 3; n, i = n.Prev, i+1 {
+		if n.Type != bf.HTMLSpan && n.Type != bf.Text {
+			return false
+		}
+		if n.Type == bf.HTMLSpan && bytes.Contains(n.Literal, []byte("footnote-return")) {
+			return i == 0 || !bytes.Contains(n.Literal, []byte("</a>"))
+		}
+	}
+	return false
+}
+
+// inFootnote tells if a node is part of a footnote definition
+func inFootnote(node *bf.Node) bool {
+	for ; node != nil; node = node.Parent {
+		if node.Type == bf.Item && node.RefLink != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// endsWithInline tells if the content of a footnote definition ends with
+// inline nodes: blackfriday puts the text of single paragraph footnotes right
+// under their item, with no paragraph to end the line
+func endsWithInline(item *bf.Node) bool {
+	if item.LastChild == nil {
+		return false
+	}
+	switch item.LastChild.Type {
+	case bf.Text, bf.Emph, bf.Strong, bf.Del, bf.Link, bf.Image, bf.Code, bf.HTMLSpan, bf.Softbreak, bf.Hardbreak:
+		return true
+	}
+	return false
+}
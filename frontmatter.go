@@ -0,0 +1,52 @@
+package bfmdrenderer
+
+import (
+	"bytes"
+)
+
+var frontMatterDelimiter = []byte("---")
+
+// StripFrontMatter detects a leading front matter block (delimited by "---"
+// lines) and removes it from input. The block is kept aside and emitted
+// verbatim by RenderHeader.
+//
+// Blackfriday does not know about front matter and mangles it into rules and
+// headings, so it has to be handled before the input is parsed:
+//
+//	r := NewRenderer(WithFrontMatter())
+//	output := bf.Run(r.StripFrontMatter(input), bf.WithRenderer(r))
+//
+// Without the WithFrontMatter option, input is returned unchanged.
+func (r *Renderer) StripFrontMatter(input []byte) []byte {
+	r.frontMatter = nil
+	if !r.keepFrontMatter {
+		return input
+	}
+
+	line, rest := nextLine(input)
+	if !bytes.Equal(bytes.TrimRight(line, "\r\n"), frontMatterDelimiter) {
+		return input
+	}
+
+	end := len(line)
+	for len(rest) > 0 {
+		line, rest = nextLine(rest)
+		end += len(line)
+		if bytes.Equal(bytes.TrimRight(line, "\r\n"), frontMatterDelimiter) {
+			r.frontMatter = input[:end]
+			return rest
+		}
+	}
+
+	// No closing delimiter, this is not front matter
+	return input
+}
+
+// nextLine splits the first line (including its line feed) from the rest of data
+func nextLine(data []byte) ([]byte, []byte) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return data, nil
+	}
+	return data[:i+1], data[i+1:]
+}
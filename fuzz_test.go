@@ -0,0 +1,57 @@
+//go:build go1.18
+// +build go1.18
+
+package bfmdrenderer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// fuzzExtensions are the extensions the fuzzed input is parsed with. Footnotes
+// are left out: Blackfriday itself never returns on some malformed footnote
+// definitions.
+const fuzzExtensions = bf.CommonExtensions | bf.Titleblock
+
+// fuzzParse parses data, recovering from the panics of Blackfriday itself on
+// some malformed input (definition lists, notably)
+func fuzzParse(data []byte) (ast *bf.Node, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	return bf.New(bf.WithExtensions(fuzzExtensions)).Parse(data), true
+}
+
+// FuzzRender renders arbitrary input back to Markdown, which must not panic,
+// and parses the output again, which must not make Blackfriday panic
+// either. The seed corpus lives in test/fuzz/corpus:
+//
+//	go test -fuzz FuzzRender
+func FuzzRender(f *testing.F) {
+	seeds, err := filepath.Glob(filepath.Join("test", "fuzz", "corpus", "*"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, seed := range seeds {
+		data, err := ioutil.ReadFile(seed)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ast, ok := fuzzParse(data)
+		if !ok {
+			t.Skip("Blackfriday panics on the input")
+		}
+		r := NewRenderer(WithExtensions(fuzzExtensions), WithEscaping())
+		output := RenderNodeToString(r, ast)
+		bf.New(bf.WithExtensions(fuzzExtensions)).Parse([]byte(output))
+	})
+}
@@ -0,0 +1,94 @@
+package bfmdrenderer
+
+import (
+	"bytes"
+	"io"
+)
+
+// lintWriter normalizes the rendered output line by line for WithLintFriendly:
+// it trims trailing whitespace, collapses runs of blank lines and ends the
+// document with a single newline. Fenced code blocks are left untouched.
+type lintWriter struct {
+	w       io.Writer
+	line    []byte
+	blank   bool
+	started bool
+	fence   []byte
+}
+
+// Write buffers p and writes out the complete lines it contains
+func (l *lintWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if c != '\n' {
+			l.line = append(l.line, c)
+			continue
+		}
+		l.writeLine(l.line)
+		l.line = l.line[:0]
+	}
+	return len(p), nil
+}
+
+// fenceOf returns the fence opening or closing a fenced code block on line,
+// once stripped of its blockquote and list decorations, or nil
+func fenceOf(line []byte) []byte {
+	line = bytes.TrimLeft(line, "> ")
+	if len(line) < 3 || (line[0] != '`' && line[0] != '~') {
+		return nil
+	}
+	run := 0
+	for run < len(line) && line[run] == line[0] {
+		run++
+	}
+	if run < 3 {
+		return nil
+	}
+	return line[:run]
+}
+
+// trimTrailingSpace trims the trailing whitespace of line, except for the two
+// spaces of a hard line break (markdownlint's MD009 default)
+func trimTrailingSpace(line []byte) []byte {
+	trimmed := bytes.TrimRight(line, " \t")
+	if len(line)-len(trimmed) >= 2 && len(trimmed) > 0 && bytes.HasSuffix(line, []byte("  ")) {
+		return line[:len(trimmed)+2]
+	}
+	return trimmed
+}
+
+// writeLine writes line, holding back blank lines until the next non-blank one
+func (l *lintWriter) writeLine(line []byte) {
+	if l.fence != nil {
+		l.w.Write(line)
+		l.w.Write([]byte("\n"))
+		// Only a fence of the same kind, at least as long, closes the block
+		if fence := fenceOf(line); fence != nil && fence[0] == l.fence[0] && len(fence) >= len(l.fence) {
+			l.fence = nil
+		}
+		return
+	}
+
+	line = trimTrailingSpace(line)
+	if len(line) == 0 {
+		l.blank = true
+		return
+	}
+	if l.started && l.blank {
+		l.w.Write([]byte("\n"))
+	}
+	l.blank = false
+	l.started = true
+	l.w.Write(line)
+	l.w.Write([]byte("\n"))
+	if fence := fenceOf(line); fence != nil {
+		l.fence = append([]byte(nil), fence...)
+	}
+}
+
+// flush writes the last, unterminated line. Trailing blank lines are dropped.
+func (l *lintWriter) flush() {
+	if len(l.line) > 0 {
+		l.writeLine(l.line)
+		l.line = l.line[:0]
+	}
+}
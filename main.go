@@ -1,19 +1,64 @@
 package bfmdrenderer
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	bf "github.com/russross/blackfriday/v2"
 )
 
+// HardBreakStyle defines how hard line breaks are written
+type HardBreakStyle int
+
+const (
+	// HardBreakSpaces ends the line with two spaces
+	HardBreakSpaces HardBreakStyle = iota
+	// HardBreakBackslash ends the line with a backslash
+	HardBreakBackslash
+	// HardBreakHTML ends the line with a <br> tag
+	HardBreakHTML
+)
+
+// TitleStyle defines how the titles of links and images are delimited
+type TitleStyle int
+
+const (
+	// TitleDoubleQuotes delimits titles with double quotes
+	TitleDoubleQuotes TitleStyle = iota
+	// TitleSingleQuotes delimits titles with single quotes
+	TitleSingleQuotes
+	// TitleParentheses delimits titles with parentheses
+	TitleParentheses
+)
+
+// SetextUnderline defines the width of the underline of setext headings
+type SetextUnderline int
+
+const (
+	// SetextUnderlineMatch underlines the whole heading text
+	SetextUnderlineMatch SetextUnderline = iota
+	// SetextUnderlineFixed always uses a three-character underline
+	SetextUnderlineFixed
+)
+
 // Option defines the functional option type
 type Option func(r *Renderer)
 
 // NewRenderer will return a new renderer with sane defaults
 func NewRenderer(options ...Option) *Renderer {
-	r := &Renderer{}
+	r := &Renderer{
+		listMarkerSpacing: 1,
+		blockquotePrefix:  []byte("> "),
+		ruleSpacing:       1,
+		definitionSpacing: 1,
+	}
 	for _, option := range options {
 		option(r)
 	}
@@ -22,10 +67,147 @@ func NewRenderer(options ...Option) *Renderer {
 
 // Renderer is a custom Blackfriday renderer
 type Renderer struct {
-	paragraphDecoration  []byte
+	paragraphDecoration  decoration
 	nestedListLevel      int
-	nestedListDecoration []byte
+	nestedListDecoration decoration
+	quotedLists          []quotedList
 	orderedListCounters  []int
+	orderedListWidths    []int
+	stripComments        bool
+	keepFrontMatter      bool
+	frontMatter          []byte
+	collapseSpaces       bool
+	linkRewriter         func(dest []byte) []byte
+	textTransformer      func(text []byte) []byte
+	headingCase          HeadingCase
+	escapeText           bool
+	smartUnderscores     bool
+	tableOfContents      bool
+	tocEntries           []tocEntry
+	headingSlugger       func(text string) string
+	headingIDs           bool
+	headingAnchors       map[*bf.Node]string
+	lazyBlockquotes      bool
+	stripHTML            bool
+	logger               *log.Logger
+	forceCloseMarkup     bool
+	openInlines          []*bf.Node
+	listBaseIndent       int
+	referenceLinks       bool
+	referenceImages      bool
+	definitionOrder      DefinitionOrder
+	references           []reference
+	referencesByLabel    map[string]int
+	referencesByTarget   map[string]int
+	warnings             []error
+	strippedHTML         [][]byte
+	listMarkerSpacing    int
+	markerWidths         []int
+	wrapWidth            int
+	wrapping             bool
+	setextHeadings       bool
+	setextUnderline      SetextUnderline
+	tightHeadings        bool
+	bulletChar           byte
+	lintFriendly         bool
+	root                 io.Writer
+	out                  io.Writer
+	lint                 *lintWriter
+	budget               *budgetWriter
+	maxOutputBytes       int
+	internalBuffer       bool
+	buffer               bytes.Buffer
+	inlineHTML           bool
+	paddedTables         bool
+	headerComment        string
+	escapePipes          bool
+	allOnesNumbering     bool
+	analyzeOnly          bool
+	stats                map[bf.NodeType]int
+	blockquotePrefix     []byte
+	ruleSpacing          int
+	plainImageAlt        bool
+	codeTabWidth         int
+	definitionSpacing    int
+	dropEmptyBlocks      bool
+	gfmAlerts            bool
+	dropEmptyImages      bool
+	extensions           bf.Extensions
+	hardBreakStyle       HardBreakStyle
+	titleStyle           TitleStyle
+	typographicDashes    bool
+	emphasisStyle        byte
+	simpleListIndent     bool
+	minColumnWidth       int
+	sourceLine           func(node *bf.Node) (int, bool)
+	streaming            bool
+	preserveBackslashes  bool
+	mergeEmphasis        bool
+	minInlineBackticks   int
+	trimCodeSpaces       bool
+	fenceLanguageOnly    bool
+	headingOffset        int
+	maxHeadingLevel      int
+	validation           bool
+	validator            *validator
+	continuation         []byte
+	orderedAlignment     bool
+	normalizeEmphasis    bool
+	nodeHandler          func(w io.Writer, node *bf.Node, entering bool) (bf.WalkStatus, bool)
+
+	// scratch is a reusable buffer to format list markers without allocating
+	scratch []byte
+}
+
+var (
+	// definitionMarker introduces a definition, aligned on the next tab stop
+	definitionMarker = []byte(":   ")
+	// definitionIndent is the indentation of a continuation paragraph in a definition
+	definitionIndent = []byte("    ")
+	// itemIndent is the indentation of the blocks following the first one in
+	// a list item. Blackfriday expects them on the next tab stop.
+	itemIndent = []byte("    ")
+	// inlineTags are the HTML tags of the spans rendered by WithInlineHTMLOutput
+	inlineTags = map[bf.NodeType]string{
+		bf.Emph:   "em",
+		bf.Strong: "strong",
+		bf.Del:    "del",
+	}
+)
+
+// appendMarkerSpacing appends the spaces that follow a list marker
+func (r *Renderer) appendMarkerSpacing(marker []byte) []byte {
+	for i := 0; i < r.listMarkerSpacing; i++ {
+		marker = append(marker, ' ')
+	}
+	return marker
+}
+
+// orderedListWidth returns the width of the widest number of an ordered list
+func orderedListWidth(list *bf.Node, allOnes bool) int {
+	if allOnes {
+		return 1
+	}
+	count := 0
+	for item := list.FirstChild; item != nil; item = item.Next {
+		count++
+	}
+	return len(strconv.Itoa(count))
+}
+
+// isDefinitionList tells if node is a definition list
+func isDefinitionList(node *bf.Node) bool {
+	return node.Type == bf.List && node.ListFlags&bf.ListTypeDefinition != 0
+}
+
+// isDefinitionListItem tells if node is a term or a definition of a definition list
+func isDefinitionListItem(node *bf.Node) bool {
+	return node != nil && node.Type == bf.Item && node.ListFlags&bf.ListTypeDefinition != 0
+}
+
+// isDefinition tells if node is a definition (but not a term) of a definition list
+func isDefinition(node *bf.Node) bool {
+	return isDefinitionListItem(node) && node.ListFlags&bf.ListTypeTerm == 0
 }
 
 // Taken from the black friday HTML renderer
@@ -43,138 +225,1070 @@ func skipParagraphTags(node *bf.Node) bool {
 	return grandparent.Type == bf.List && grandparent.Tight
 }
 
+// isEmptyBlock tells if node is a paragraph, a heading or a list item with
+// no visible content
+func isEmptyBlock(node *bf.Node) bool {
+	if node.Type != bf.Paragraph && node.Type != bf.Heading && node.Type != bf.Item {
+		return false
+	}
+	empty := true
+	node.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		switch node.Type {
+		case bf.Text:
+			empty = len(bytes.TrimSpace(node.Literal)) == 0
+		case bf.Code, bf.CodeBlock, bf.Image, bf.HTMLSpan, bf.HTMLBlock, bf.HorizontalRule, bf.Table:
+			empty = false
+		}
+		if !empty {
+			return bf.Terminate
+		}
+		return bf.GoToNext
+	})
+	return empty
+}
+
+// isHTMLComment tells if a raw HTML literal is a comment (<!-- ... -->)
+func isHTMLComment(literal []byte) bool {
+	literal = bytes.TrimSpace(literal)
+	return bytes.HasPrefix(literal, []byte("<!--")) && bytes.HasSuffix(literal, []byte("-->"))
+}
+
+// escapeDestination makes a link destination safe to be written between
+// parenthesis. Blackfriday ends a destination at its first closing
+// parenthesis, nested or not: parentheses are backslash-escaped, which both
+// Blackfriday and CommonMark read back. Destinations with spaces or angle
+// brackets are written between pointy brackets, where parentheses need no
+// escaping.
+func escapeDestination(dest []byte) []byte {
+	pointy, parentheses := false, false
+	for _, c := range dest {
+		switch c {
+		case ' ', '\t', '\n', '\r', '<', '>':
+			pointy = true
+		case '(', ')':
+			parentheses = true
+		}
+	}
+	if !pointy && !parentheses {
+		return dest
+	}
+
+	out := make([]byte, 0, len(dest)+2)
+	if pointy {
+		out = append(out, '<')
+	}
+	for _, c := range dest {
+		if (pointy && (c == '<' || c == '>')) || (!pointy && (c == '(' || c == ')')) {
+			out = append(out, '\\')
+		}
+		out = append(out, c)
+	}
+	if pointy {
+		out = append(out, '>')
+	}
+	return out
+}
+
+// writeTitle writes the title of a link or an image, delimited as set by
+// WithTitleStyle. Blackfriday keeps the backslash escapes of titles: only the
+// delimiters left unescaped need to be escaped.
+func (r *Renderer) writeTitle(w io.Writer, title []byte) {
+	opening, closing := byte('"'), byte('"')
+	switch r.titleStyle {
+	case TitleSingleQuotes:
+		opening, closing = '\'', '\''
+	case TitleParentheses:
+		opening, closing = '(', ')'
+	}
+	w.Write([]byte{opening})
+	for i, c := range title {
+		if (c == opening || c == closing) && (i == 0 || title[i-1] != '\\') {
+			w.Write([]byte("\\"))
+		}
+		w.Write([]byte{c})
+	}
+	w.Write([]byte{closing})
+}
+
+// writeInlineTarget writes the destination and the title of an inline link
+// or image, from the parenthesis on
+func (r *Renderer) writeInlineTarget(w io.Writer, node *bf.Node) {
+	w.Write([]byte("]("))
+	dest, size := splitImageSize(node.LinkData.Destination)
+	r.writeDestination(w, dest)
+	w.Write(size)
+	if len(node.LinkData.Title) > 0 {
+		w.Write([]byte(" "))
+		r.writeTitle(w, node.LinkData.Title)
+	}
+	w.Write([]byte(")"))
+}
+
+// splitImageSize splits the " =WIDTHxHEIGHT" size suffix some flavors append
+// to image destinations. Blackfriday keeps it as part of the destination.
+func splitImageSize(dest []byte) ([]byte, []byte) {
+	i := bytes.LastIndex(dest, []byte(" ="))
+	if i < 0 {
+		return dest, nil
+	}
+	size := dest[i+2:]
+	x := bytes.IndexByte(size, 'x')
+	if x < 0 || len(size) == 1 {
+		return dest, nil
+	}
+	for j, c := range size {
+		if j != x && (c < '0' || c > '9') {
+			return dest, nil
+		}
+	}
+	return bytes.TrimRight(dest[:i], " "), dest[i:]
+}
+
+// writeDestination writes the destination of a link or an image
+func (r *Renderer) writeDestination(w io.Writer, dest []byte) {
+	if r.linkRewriter != nil {
+		dest = r.linkRewriter(dest)
+	}
+	w.Write(escapeDestination(dest))
+}
+
+// trailingPunctuation are the characters GFM leaves out of the end of bare
+// autolinks
+const trailingPunctuation = "?!.,:*_~"
+
+// bareAutolinkBoundary tells if a GFM parser would end a bare autolink of
+// text exactly where next begins. GFM trims trailing punctuation and
+// unbalanced closing parentheses from bare links, and extends them up to the
+// next whitespace.
+func bareAutolinkBoundary(text []byte, next *bf.Node) bool {
+	last := text[len(text)-1]
+	if strings.IndexByte(trailingPunctuation, last) >= 0 ||
+		last == ')' && bytes.Count(text, []byte("(")) < bytes.Count(text, []byte(")")) {
+		return false
+	}
+	if next == nil || next.Type != bf.Text {
+		return next == nil || next.Type == bf.Softbreak || next.Type == bf.Hardbreak
+	}
+	following := bytes.TrimLeft(next.Literal, trailingPunctuation+")")
+	return len(following) == 0 || following[0] == '<' || isWhitespace(following[0])
+}
+
+// autolink tells if a link can be written as an autolink, because its text
+// is its destination: either <destination> or, for www. domains that GFM
+// links by itself, the bare text. Other bare domains (example.com) keep the
+// explicit form since no parser links them back.
+func (r *Renderer) autolink(node *bf.Node) (text []byte, bare bool, ok bool) {
+	if node.NoteID != 0 || len(node.Title) > 0 || node.FirstChild == nil ||
+		node.FirstChild != node.LastChild || node.FirstChild.Type != bf.Text {
+		return nil, false, false
+	}
+
+	text = node.FirstChild.Literal
+	dest := node.Destination
+	if r.linkRewriter != nil {
+		dest = r.linkRewriter(dest)
+	}
+	switch {
+	case bytes.Equal(text, dest) && bytes.Contains(dest, []byte("://")):
+		return dest, false, true
+	case bytes.Equal(dest, append([]byte("mailto:"), text...)):
+		return text, false, true
+	case bytes.HasPrefix(text, []byte("www.")) && bytes.Equal(dest, append([]byte("http://"), text...)) &&
+		bareAutolinkBoundary(text, node.Next):
+		return text, true, true
+	}
+	return nil, false, false
+}
+
+// inlineDelimiter returns the delimiter of an emphasis, strong or strikethrough
+// span, or its opening or closing HTML tag with WithInlineHTMLOutput
+func (r *Renderer) inlineDelimiter(node *bf.Node, entering bool) []byte {
+	if r.inlineHTML {
+		tag := inlineTags[node.Type]
+		if entering {
+			return []byte("<" + tag + ">")
+		}
+		return []byte("</" + tag + ">")
+	}
+
+	switch node.Type {
+	case bf.Strong:
+		c := r.emphasisChar(node)
+		return []byte{c, c}
+	case bf.Del:
+		return []byte("~~")
+	default:
+		return []byte{r.emphasisChar(node)}
+	}
+}
+
+// soleChild returns the only child of node, empty text nodes aside, or nil
+func soleChild(node *bf.Node) *bf.Node {
+	var sole *bf.Node
+	for child := node.FirstChild; child != nil; child = child.Next {
+		if child.Type == bf.Text && len(child.Literal) == 0 {
+			continue
+		}
+		if sole != nil {
+			return nil
+		}
+		sole = child
+	}
+	return sole
+}
+
+// spansEnclosingEmphasis tells if node is an emphasis or strong emphasis that
+// is the whole content of an enclosing one
+func spansEnclosingEmphasis(node *bf.Node) bool {
+	parent := node.Parent
+	return parent != nil && (parent.Type == bf.Emph || parent.Type == bf.Strong) && soleChild(parent) == node
+}
+
+// adjacentSpan returns the span of the same type right before (or after) an
+// inline span, with nothing but empty text in between, or nil
+func adjacentSpan(node *bf.Node, before bool) *bf.Node {
+	next := func(n *bf.Node) *bf.Node {
+		if before {
+			return n.Prev
+		}
+		return n.Next
+	}
+	sibling := next(node)
+	for sibling != nil && sibling.Type == bf.Text && len(sibling.Literal) == 0 {
+		sibling = next(sibling)
+	}
+	if sibling != nil && sibling.Type == node.Type {
+		return sibling
+	}
+	return nil
+}
+
+// emphasisChar returns the delimiter character of an emphasis or strong
+// emphasis. ***x*** reads as an emphasis within a strong emphasis: other
+// kinds of emphasis spanning a whole enclosing one alternate between * and _
+// (*__x__*, **__x__**), or they would not read back as the same nesting.
+func (r *Renderer) emphasisChar(node *bf.Node) byte {
+	if !spansEnclosingEmphasis(node) {
+		// Merged spans share their delimiters: the first one opens, the
+		// last one closes
+		first, last := node, node
+		for r.mergeEmphasis && adjacentSpan(first, true) != nil {
+			first = adjacentSpan(first, true)
+		}
+		for r.mergeEmphasis && adjacentSpan(last, false) != nil {
+			last = adjacentSpan(last, false)
+		}
+		// Underscores do not delimit emphasis within a word
+		if r.emphasisStyle == '_' && !intraword(first, last) {
+			return '_'
+		}
+		return '*'
+	}
+	c := r.emphasisChar(node.Parent)
+	if node.Type == bf.Emph && node.Parent.Type == bf.Strong {
+		return c
+	}
+	if c == '*' {
+		return '_'
+	}
+	return '*'
+}
+
+// intraword tells if the inline nodes from first to last are rendered within
+// a word
+func intraword(first, last *bf.Node) bool {
+	for _, c := range []byte{adjacentChar(first, first.Prev, true), adjacentChar(last, last.Next, false)} {
+		if isAlphanumeric(c) || c >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+// writeDelimiter writes the delimiter of an emphasis, strong or strikethrough
+// span. When unbalanced markup is closed by force, open spans are tracked so
+// that they can be closed when the enclosing block ends.
+func (r *Renderer) writeDelimiter(w io.Writer, node *bf.Node, entering bool) {
+	// A strong emphasis of a strong emphasis is a mere strong emphasis
+	if r.normalizeEmphasis && node.Type != bf.Del && node.Parent.Type == node.Type && spansEnclosingEmphasis(node) {
+		return
+	}
+	// Adjacent spans of the same type make a single one (*a**b* is *ab*)
+	if r.mergeEmphasis && !entering && adjacentSpan(node, false) != nil {
+		return
+	}
+	if r.mergeEmphasis && entering {
+		if previous := adjacentSpan(node, true); previous != nil {
+			// The span left open by the previous one is now closed by this one
+			for i := range r.openInlines {
+				if r.openInlines[i] == previous {
+					r.openInlines[i] = node
+				}
+			}
+			return
+		}
+	}
+	if !r.forceCloseMarkup {
+		w.Write(r.inlineDelimiter(node, entering))
+		return
+	}
+
+	if entering {
+		r.openInlines = append(r.openInlines, node)
+		w.Write(r.inlineDelimiter(node, true))
+		return
+	}
+
+	for i := len(r.openInlines) - 1; i >= 0; i-- {
+		if r.openInlines[i] == node {
+			r.closeInlines(w, i)
+			return
+		}
+	}
+	// Already closed when its block ended
+}
+
+// closeInlines closes the spans left open from the given depth, innermost first
+func (r *Renderer) closeInlines(w io.Writer, depth int) {
+	for i := len(r.openInlines) - 1; i >= depth; i-- {
+		w.Write(r.inlineDelimiter(r.openInlines[i], false))
+	}
+	r.openInlines = r.openInlines[:depth]
+}
+
+// writeBlockPrefix writes the decoration of the first line of a block: the
+// blockquote markers and, for a block following the first one of a list
+// item, the indentation of the item content
+func (r *Renderer) writeBlockPrefix(w io.Writer, node *bf.Node) {
+	// A blockquote opening a list item starts on the line of the item marker
+	if depth := itemQuoteDepth(node); depth > 0 {
+		w.Write(bytes.Repeat(r.blockquotePrefix, depth))
+		return
+	}
+	w.Write(r.paragraphDecoration.bytes)
+	if node.Parent != nil && node.Parent.Type == bf.Item && !isDefinitionListItem(node.Parent) && node.Prev != nil {
+		w.Write(r.nestedListDecoration.bytes)
+		w.Write(r.itemBlockIndent())
+	}
+}
+
+// markerWidth returns the width of the marker of the innermost open list item
+func (r *Renderer) markerWidth() int {
+	if len(r.markerWidths) == 0 {
+		return 0
+	}
+	return r.markerWidths[len(r.markerWidths)-1]
+}
+
+// itemBlockIndent returns the indentation of the blocks following the first
+// one in the innermost open list item. Multi-digit ordered markers ("100. ")
+// push the item content past the usual tab stop.
+func (r *Renderer) itemBlockIndent() []byte {
+	if width := r.markerWidth(); width > len(itemIndent) {
+		return bytes.Repeat([]byte(" "), width)
+	}
+	return itemIndent
+}
+
+// writeBlankLine writes a line separating two blocks, which keeps the
+// blockquote markers so that the quote goes on. The indentation of list items
+// is left out: it would only be trailing whitespace.
+func (r *Renderer) writeBlankLine(w io.Writer) {
+	w.Write(bytes.TrimRight(r.paragraphDecoration.bytes, " "))
+	w.Write([]byte("\n"))
+}
+
+// endHeadingText terminates the text of a heading, adding its anchor if required
+func (r *Renderer) endHeadingText(w io.Writer, node *bf.Node) {
+	r.closeInlines(w, 0)
+	if r.headingIDs {
+		w.Write([]byte(" {#"))
+		w.Write([]byte(r.headingAnchors[node]))
+		w.Write([]byte("}"))
+	}
+}
+
+// endImage writes the end of an image, from its alternate text onwards
+func (r *Renderer) endImage(w io.Writer, node *bf.Node) {
+	if r.referenceImages {
+		w.Write([]byte("]["))
+		w.Write(escapeText([]byte(r.referenceLabel(node))))
+		w.Write([]byte("]"))
+		return
+	}
+	r.writeInlineTarget(w, node)
+}
+
+// codeBlockContent returns the code of a code block. Blackfriday puts it in
+// the literal and walks no further, code blocks not being containers: should
+// a tree hold text nodes under a code block, they are used only when the
+// literal is empty, so that the code is never written twice.
+func codeBlockContent(node *bf.Node) []byte {
+	if len(node.Literal) > 0 || node.FirstChild == nil {
+		return node.Literal
+	}
+	var code []byte
+	for child := node.FirstChild; child != nil; child = child.Next {
+		code = append(code, child.Literal...)
+	}
+	return code
+}
+
+// renderCodeBlock writes a fenced code block. Every line is decorated, so
+// that code blocks stay in their blockquote or list item.
+func (r *Renderer) renderCodeBlock(w io.Writer, node *bf.Node, code []byte) {
+	// The first block of an item follows the item marker
+	if node.Parent.Type != bf.Item || node.Prev != nil {
+		r.writeBlockPrefix(w, node)
+	}
+	info := node.CodeBlockData.Info
+	if fields := bytes.Fields(info); r.fenceLanguageOnly && len(fields) > 0 {
+		info = fields[0]
+	}
+	fence := codeFence(info, code)
+	w.Write(fence)
+	w.Write(info)
+	w.Write([]byte("\n"))
+
+	prefix := r.continuationPrefix(node)
+	// Only the newline ending the last line is trimmed: the blank lines the
+	// code ends with are part of it, and a last line without a newline still
+	// gets one before the closing fence
+	lines := bytes.Split(bytes.TrimSuffix(code, []byte("\n")), []byte("\n"))
+	if len(code) == 0 {
+		lines = nil
+	}
+	for _, line := range lines {
+		if len(line) == 0 {
+			w.Write(bytes.TrimRight(prefix, " "))
+		} else {
+			w.Write(prefix)
+			w.Write(line)
+		}
+		w.Write([]byte("\n"))
+	}
+	w.Write(prefix)
+	w.Write(fence)
+	w.Write([]byte("\n"))
+
+	// The last block of a blockquote is followed by the blank line ending it
+	if node.Next != nil || node.Parent.Type != bf.BlockQuote {
+		r.writeBlankLine(w)
+	}
+}
+
+// hardBreak returns a hard line break in the configured style. Stripping
+// HTML turns <br> breaks into mere newlines.
+func (r *Renderer) hardBreak() []byte {
+	switch r.hardBreakStyle {
+	case HardBreakBackslash:
+		return []byte("\\\n")
+	case HardBreakHTML:
+		if r.stripHTML {
+			r.lose("Hardbreak stripped")
+			return []byte("\n")
+		}
+		return []byte("<br>\n")
+	default:
+		return []byte("  \n")
+	}
+}
+
+// headingLevel returns the level node is rendered at, once shifted by
+// WithHeadingOffset and clamped by WithMaxHeadingLevel. Markdown has six
+// heading levels: deeper headings are clamped to level 6.
+func (r *Renderer) headingLevel(node *bf.Node) int {
+	level := node.Level + r.headingOffset
+	if r.maxHeadingLevel > 0 && level > r.maxHeadingLevel {
+		level = r.maxHeadingLevel
+	}
+	if level > 6 {
+		level = 6
+	} else if level < 1 {
+		level = 1
+	}
+	return level
+}
+
+// headingMarker returns the # run of an ATX heading. Headings deeper than
+// level 6, which Blackfriday never produces but a hand-built tree or an
+// offset may yield, are reported as lossy unless WithMaxHeadingLevel clamps
+// them on purpose.
+func (r *Renderer) headingMarker(node *bf.Node) []byte {
+	level := node.Level + r.headingOffset
+	if level > 6 && (r.maxHeadingLevel == 0 || r.maxHeadingLevel > 6) {
+		r.lose(fmt.Sprintf("heading level %d clamped to 6", level))
+	}
+	return bytes.Repeat([]byte("#"), r.headingLevel(node))
+}
+
+// renderSetextHeading renders a level 1 or 2 heading, underlined with = or -
+func (r *Renderer) renderSetextHeading(w io.Writer, node *bf.Node) {
+	var text bytes.Buffer
+	for child := node.FirstChild; child != nil; child = child.Next {
+		r.render(&text, child)
+	}
+	r.endHeadingText(&text, node)
+	w.Write(text.Bytes())
+	w.Write([]byte("\n"))
+
+	width := utf8.RuneCount(text.Bytes())
+	if r.setextUnderline == SetextUnderlineFixed || width < 3 {
+		width = 3
+	}
+	underline := []byte("=")
+	if r.headingLevel(node) == 2 {
+		underline = []byte("-")
+	}
+	r.writeBlockPrefix(w, node)
+	w.Write(bytes.Repeat(underline, width))
+	w.Write([]byte("\n"))
+	// The last block of a blockquote is followed by the blank line ending it
+	if node.Next != nil || node.Parent.Type != bf.BlockQuote {
+		r.writeBlankLine(w)
+	}
+}
+
+// renderHTMLBlock writes a raw HTML block. Unlike paragraphs, HTML blocks
+// have no lazy continuation: every line gets the decoration of the blockquote
+// or list item the block is in.
+func (r *Renderer) renderHTMLBlock(w io.Writer, node *bf.Node) {
+	// The first block of an item follows the item marker
+	if node.Parent.Type != bf.Item || node.Prev != nil {
+		r.writeBlockPrefix(w, node)
+	}
+	prefix := r.continuationPrefix(node)
+	lines := bytes.Split(bytes.TrimRight(node.Literal, "\n"), []byte("\n"))
+	for i, line := range lines {
+		if i > 0 && len(line) == 0 {
+			w.Write(bytes.TrimRight(prefix, " "))
+		} else if i > 0 {
+			w.Write(prefix)
+		}
+		w.Write(line)
+		w.Write([]byte("\n"))
+	}
+	// The last block of a blockquote is followed by the blank line ending it
+	if node.Parent.Type != bf.BlockQuote || node.Next != nil {
+		r.writeBlankLine(w)
+	}
+}
+
+// endParagraph terminates a paragraph
+func (r *Renderer) endParagraph(w io.Writer, node *bf.Node) {
+	r.closeInlines(w, 0)
+	w.Write([]byte("\n"))
+	if node.Parent.Type == bf.BlockQuote {
+		// The last block of a blockquote is followed by the blank line ending it
+		if node.Next != nil {
+			r.writeBlankLine(w)
+		}
+	} else if !skipParagraphTags(node) && !isDefinitionListItem(node.Parent) {
+		r.writeBlankLine(w)
+	}
+}
+
+// escapeTextNode escapes the text of a node, including the characters that
+// would start a block when the node begins its paragraph
+func (r *Renderer) escapeTextNode(node *bf.Node, text []byte) []byte {
+	escape := escapeText
+	if r.smartUnderscores {
+		before, after := adjacentChar(node, node.Prev, true), adjacentChar(node, node.Next, false)
+		escape = func(text []byte) []byte {
+			return escapeTextSmart(text, before, after)
+		}
+	}
+
+	if checkbox := taskCheckbox(node, text); checkbox != nil {
+		return append(append([]byte(nil), checkbox...), escape(text[len(checkbox):])...)
+	}
+
+	// Markers starting a block are escaped at the beginning of every line,
+	// which would otherwise start a list (1. item) or a heading in the
+	// middle of the paragraph. The first line has no heading to underline.
+	var markers []int
+	if head, first, ok := blockLine(node); ok {
+		line := append(head, text...)
+		if i := blockMarkerIndex(line) - len(head); i >= 0 && i < len(text) && !(first && line[len(head)+i] == '=') {
+			markers = append(markers, i)
+		}
+	}
+	for i := bytes.IndexByte(text, '\n'); i >= 0; {
+		if j := blockMarkerIndex(text[i+1:]); j >= 0 {
+			markers = append(markers, i+1+j)
+		}
+		next := bytes.IndexByte(text[i+1:], '\n')
+		if next < 0 {
+			break
+		}
+		i += 1 + next
+	}
+	if len(markers) == 0 {
+		return escape(text)
+	}
+
+	var out []byte
+	start := 0
+	for _, i := range markers {
+		out = append(out, escape(text[start:i])...)
+		out = append(out, '\\')
+		start = i
+	}
+	return append(out, escape(text[start:])...)
+}
+
+// keepHTML tells if a raw HTML block or span has to be written. Comments are
+// kept even when HTML is stripped, unless comments are stripped too.
+func (r *Renderer) keepHTML(literal []byte) bool {
+	if isHTMLComment(literal) {
+		return !r.stripComments
+	}
+	return !r.stripHTML
+}
+
+// lose records that the output does not faithfully represent the document
+func (r *Renderer) lose(reason string) {
+	r.warnings = append(r.warnings, errors.New(reason))
+}
+
+// warn reports a construct that the renderer cannot handle
+func (r *Renderer) warn(err error) {
+	r.warnings = append(r.warnings, err)
+	if r.logger != nil {
+		r.logger.Print(err)
+	} else {
+		log.Print(err)
+	}
+}
+
+// writeLines writes inline content, prefixing the lines after a soft or hard
+// break with the blockquote decoration (unless blockquotes are lazy) and, in a
+// list item, the indentation aligning them under the first line
+func (r *Renderer) writeLines(w io.Writer, text []byte) {
+	prefix := r.paragraphDecoration.bytes
+	if r.continuation != nil {
+		prefix = r.continuation
+	}
+	// When wrapping, decorations are added once the lines are known
+	if r.wrapping || r.lazyBlockquotes || len(prefix) == 0 {
+		w.Write(text)
+		return
+	}
+
+	for {
+		i := bytes.IndexByte(text, '\n')
+		if i < 0 {
+			w.Write(text)
+			return
+		}
+		w.Write(text[:i+1])
+		w.Write(prefix)
+		text = text[i+1:]
+	}
+}
+
 // RenderNode satisfies the Renderer interface
 func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.WalkStatus {
+	w = r.output(w)
+	if r.analyzeOnly {
+		w = ioutil.Discard
+	}
+	if r.nodeHandler != nil {
+		if status, handled := r.nodeHandler(w, node, entering); handled {
+			return status
+		}
+	}
+	if r.budget != nil && r.budget.exhausted() {
+		if !r.budget.reported {
+			r.budget.reported = true
+			r.lose(fmt.Sprintf("output truncated at %d bytes", r.maxOutputBytes))
+		}
+		return bf.Terminate
+	}
+	if r.dropEmptyBlocks && entering && isEmptyBlock(node) {
+		return bf.SkipChildren
+	}
+	if r.sourceLine != nil && entering && node.Parent != nil && node.Parent.Type == bf.Document {
+		// Only top-level blocks are annotated: a comment within a list item,
+		// a table or a code block would break it
+		if line, ok := r.sourceLine(node); ok {
+			fmt.Fprintf(w, "<!-- L%d -->\n\n", line)
+		}
+	}
 	switch node.Type {
 	case bf.Document:
 		return bf.GoToNext
 	case bf.BlockQuote:
 		if entering {
-			r.paragraphDecoration = append(r.paragraphDecoration, byte('>'), byte(' '))
+			if inListItem(node) {
+				r.enterItemQuote(node)
+			} else {
+				r.paragraphDecoration.push(r.blockquotePrefix...)
+			}
 		} else {
-			r.paragraphDecoration = r.paragraphDecoration[:len(r.paragraphDecoration)-2]
+			// The decoration records the length of each level: the prefix
+			// removed is the one pushed on entry, whatever its length
+			r.paragraphDecoration.pop()
+			if inListItem(node) {
+				r.exitItemQuote()
+			}
+			// A nested blockquote ending its parent one leaves the blank
+			// line to it
+			if node.Next != nil || node.Parent.Type != bf.BlockQuote {
+				r.writeBlankLine(w)
+			}
 		}
 		return bf.GoToNext
 	case bf.List:
 		if entering {
 			r.orderedListCounters = append(r.orderedListCounters, 0)
+			if r.orderedAlignment {
+				r.orderedListWidths = append(r.orderedListWidths, orderedListWidth(node, r.allOnesNumbering))
+			}
 			r.nestedListLevel++
 			if r.nestedListLevel > 1 {
-				r.nestedListDecoration = append(r.nestedListDecoration, byte(' '), byte(' '))
+				// Nested lists are aligned on the content of their parent item,
+				// whose marker can be wider than a bullet ("10. ")
+				width := r.markerWidth()
+				if width == 0 || r.simpleListIndent {
+					width = 1 + r.listMarkerSpacing
+				}
+				indent := bytes.Repeat([]byte(" "), width)
+				if isDefinitionList(node) && node.Prev != nil {
+					// Terms would be read as the continuation of the item
+					// text: definition lists are indented and set apart
+					// like the other blocks following it
+					indent = r.itemBlockIndent()
+					if node.Prev.Type == bf.Paragraph && skipParagraphTags(node.Prev) {
+						r.writeBlankLine(w)
+					}
+				}
+				r.nestedListDecoration.push(indent...)
+			} else {
+				r.nestedListDecoration.push(bytes.Repeat([]byte(" "), r.listBaseIndent)...)
 			}
 		} else {
-			if r.nestedListLevel > 1 {
-				r.nestedListDecoration = r.nestedListDecoration[:len(r.nestedListDecoration)-2]
-			} else {
-				w.Write([]byte("\n"))
+			r.nestedListDecoration.pop()
+			// The last block of a blockquote is followed by the blank line ending it
+			if r.nestedListLevel == 1 && (node.Next != nil || node.Parent.Type != bf.BlockQuote) {
+				r.writeBlankLine(w)
+			} else if r.nestedListLevel > 1 && (node.Next != nil || isDefinitionList(node) && node.Parent.Next != nil) {
+				// The blocks following a nested list in its parent item would
+				// otherwise be read as the continuation of its last item
+				r.writeBlankLine(w)
 			}
 			r.nestedListLevel--
 			r.orderedListCounters = r.orderedListCounters[:len(r.orderedListCounters)-1]
+			if r.orderedAlignment {
+				r.orderedListWidths = r.orderedListWidths[:len(r.orderedListWidths)-1]
+			}
 		}
 
 		return bf.GoToNext
 	case bf.Item:
 		if entering {
-			w.Write(r.nestedListDecoration)
-			if node.Parent.ListFlags&bf.ListTypeOrdered != 0 {
+			// A list opening an item starts on the line of the item marker
+			if node.Prev != nil || node.Parent.Prev != nil || node.Parent.Parent == nil || node.Parent.Parent.Type != bf.Item {
+				w.Write(r.paragraphDecoration.bytes)
+				w.Write(r.nestedListDecoration.bytes)
+			}
+			if node.RefLink != nil {
+				// Footnote definitions are rendered as such, not as the
+				// ordered list blackfriday makes of them
+				w.Write(footnoteMarker(node.RefLink))
+				w.Write([]byte(": "))
+				r.markerWidths = append(r.markerWidths, footnoteIndent)
+			} else if isDefinitionListItem(node) || node.Parent.ListFlags&bf.ListTypeDefinition != 0 {
+				// Terms and definitions may come with other flags (ordered):
+				// the definition list flags take precedence, as they do for
+				// the blocks of the item
+				if node.ListFlags&bf.ListTypeTerm == 0 {
+					w.Write(definitionMarker)
+					r.markerWidths = append(r.markerWidths, len(definitionMarker))
+				} else {
+					r.markerWidths = append(r.markerWidths, 0)
+				}
+			} else if node.Parent.ListFlags&bf.ListTypeOrdered != 0 {
 				r.orderedListCounters[len(r.orderedListCounters)-1]++
-				w.Write([]byte(strconv.Itoa(r.orderedListCounters[len(r.orderedListCounters)-1])))
-				w.Write([]byte{node.ListData.Delimiter})
-				w.Write([]byte(" "))
-			} else if node.Parent.ListFlags&bf.ListTypeTerm != 0 {
-				log.Println("Definition lists not implemented by Renderer")
+				number := r.orderedListCounters[len(r.orderedListCounters)-1]
+				if r.allOnesNumbering {
+					number = 1
+				}
+				r.scratch = r.scratch[:0]
+				if r.orderedAlignment {
+					// Right-align the numbers on the widest one of the list
+					for width := len(strconv.Itoa(number)); width < r.orderedListWidths[len(r.orderedListWidths)-1]; width++ {
+						r.scratch = append(r.scratch, ' ')
+					}
+				}
+				r.scratch = strconv.AppendInt(r.scratch, int64(number), 10)
+				delimiter := node.ListData.Delimiter
+				if delimiter == 0 {
+					delimiter = '.'
+				}
+				r.scratch = append(r.scratch, delimiter)
+				r.scratch = r.appendMarkerSpacing(r.scratch)
+				w.Write(r.scratch)
+				r.markerWidths = append(r.markerWidths, len(r.scratch))
 			} else {
-				w.Write([]byte{node.ListData.BulletChar})
-				w.Write([]byte(" "))
+				bullet := node.ListData.BulletChar
+				if r.bulletChar != 0 {
+					bullet = r.bulletChar
+				} else if bullet == 0 {
+					bullet = '-'
+				}
+				r.scratch = append(r.scratch[:0], bullet)
+				r.scratch = r.appendMarkerSpacing(r.scratch)
+				w.Write(r.scratch)
+				r.markerWidths = append(r.markerWidths, len(r.scratch))
+			}
+		} else {
+			r.markerWidths = r.markerWidths[:len(r.markerWidths)-1]
+			if node.RefLink != nil && endsWithInline(node) {
+				w.Write([]byte("\n"))
+				if node.Next != nil {
+					r.writeBlankLine(w)
+				}
+			}
+			if isDefinition(node) && node.Next != nil && node.Next.ListFlags&bf.ListTypeTerm != 0 {
+				// Separate term/definition groups with blank lines
+				for i := 0; i < r.definitionSpacing; i++ {
+					r.writeBlankLine(w)
+				}
 			}
 		}
 		return bf.GoToNext
 	case bf.Paragraph:
+		if r.tableOfContents && isTOCPlaceholder(node) {
+			if entering {
+				r.writeTOC(w)
+			}
+			return bf.SkipChildren
+		}
 		if entering {
-			w.Write(r.paragraphDecoration)
-		} else {
-			w.Write([]byte("\n"))
-			if !skipParagraphTags(node) {
+			if isDefinition(node.Parent) && node.Prev != nil {
+				// Continuation paragraphs of a definition are indented under it
 				w.Write([]byte("\n"))
+				w.Write(r.paragraphDecoration.bytes)
+				w.Write(r.nestedListDecoration.bytes)
+				w.Write(definitionIndent)
+			} else if node.Parent.Type != bf.Item || node.Prev != nil {
+				// The first paragraph of an item follows its decorated marker
+				r.writeBlockPrefix(w, node)
+			}
+			if node.Parent.Type == bf.Item {
+				r.continuation = r.continuationPrefix(node)
 			}
+			// Terms of definition lists have to stay on a single line
+			if r.wrapWidth > 0 && !(isDefinitionListItem(node.Parent) && !isDefinition(node.Parent)) {
+				r.renderWrapped(w, node)
+				r.continuation = nil
+				r.endParagraph(w, node)
+				return bf.SkipChildren
+			}
+		} else {
+			r.continuation = nil
+			r.endParagraph(w, node)
 		}
 		return bf.GoToNext
 	case bf.Heading:
 		if entering {
-			for i := 0; i < node.Level; i++ {
-				w.Write([]byte("#"))
+			r.writeBlockPrefix(w, node)
+			if r.setextHeadings && r.headingLevel(node) <= 2 {
+				r.renderSetextHeading(w, node)
+				return bf.SkipChildren
+			}
+			w.Write(r.headingMarker(node))
+			if !r.tightHeadings {
+				w.Write([]byte(" "))
 			}
-			w.Write([]byte(" "))
 		} else {
-			w.Write([]byte("\n\n"))
+			// Links and images have been closed on their own exit: the
+			// anchor and the newline follow their closing parenthesis
+			r.endHeadingText(w, node)
+			w.Write([]byte("\n"))
+			// The last block of a blockquote is followed by the blank line ending it
+			if node.Next != nil || node.Parent.Type != bf.BlockQuote {
+				r.writeBlankLine(w)
+			}
 		}
 		return bf.GoToNext
 	case bf.HorizontalRule:
-		w.Write([]byte("---\n\n"))
+		r.writeBlockPrefix(w, node)
+		w.Write([]byte("---\n"))
+		// The last block of a blockquote is followed by the blank line ending it
+		for i := 0; i < r.ruleSpacing && (node.Next != nil || node.Parent.Type != bf.BlockQuote); i++ {
+			r.writeBlankLine(w)
+		}
 		return bf.GoToNext
-	case bf.Emph:
-		w.Write([]byte("*"))
-		return bf.GoToNext
-	case bf.Strong:
-		w.Write([]byte("**"))
-		return bf.GoToNext
-	case bf.Del:
-		w.Write([]byte("~~"))
+	case bf.Emph, bf.Strong, bf.Del:
+		// Line breaks within emphasis are part of its children, so the
+		// delimiters always stick to the first and last words of the span.
+		r.writeDelimiter(w, node, entering)
 		return bf.GoToNext
 	case bf.Link:
+		if node.NoteID != 0 {
+			if entering {
+				w.Write(footnoteMarker(node.Destination))
+			}
+			return bf.SkipChildren
+		}
+		if text, bare, ok := r.autolink(node); entering && ok {
+			if bare {
+				w.Write(text)
+			} else {
+				w.Write([]byte("<"))
+				w.Write(text)
+				w.Write([]byte(">"))
+			}
+			return bf.SkipChildren
+		}
+		// Destinations are written on exit, so that a linked image
+		// ([![alt](img)](url)) gets its own destination first.
 		if entering {
 			w.Write([]byte("["))
+		} else if r.referenceLinks {
+			w.Write([]byte("]["))
+			w.Write(escapeText([]byte(r.referenceLabel(node))))
+			w.Write([]byte("]"))
 		} else {
-			w.Write([]byte("]("))
-			w.Write(node.LinkData.Destination)
-			w.Write([]byte(")"))
+			r.writeInlineTarget(w, node)
 		}
 		return bf.GoToNext
 	case bf.Image:
+		if entering && r.dropEmptyImages && len(node.LinkData.Destination) == 0 {
+			r.lose("Image without destination dropped")
+			return bf.SkipChildren
+		}
 		if entering {
 			w.Write([]byte("!["))
+			if r.plainImageAlt {
+				w.Write(plainAlt(node))
+				r.endImage(w, node)
+				return bf.SkipChildren
+			}
 		} else {
-			w.Write([]byte("]("))
-			w.Write(node.LinkData.Destination)
-			w.Write([]byte(")"))
+			r.endImage(w, node)
 		}
 		return bf.GoToNext
 	case bf.Code:
-		w.Write([]byte("`"))
-		w.Write(node.Literal)
-		w.Write([]byte("`"))
+		delimiter, pad := codeSpanDelimiter(node.Literal, r.minInlineBackticks)
+		w.Write(delimiter)
+		if pad {
+			w.Write([]byte(" "))
+		}
+		if inHeading(node) {
+			w.Write(joinLines(node.Literal))
+		} else {
+			r.writeLines(w, node.Literal)
+		}
+		if pad {
+			w.Write([]byte(" "))
+		}
+		w.Write(delimiter)
 		return bf.GoToNext
 	case bf.Text:
-		w.Write(node.Literal)
+		if isFootnoteBackReference(node) {
+			return bf.GoToNext
+		}
+		text := node.Literal
+		if r.gfmAlerts {
+			// Alert markers must not be escaped, nor joined to the body
+			if marker, rest, ok := splitAlertMarker(node, text); ok {
+				w.Write(marker)
+				r.writeLines(w, []byte("\n"))
+				text = rest
+			}
+		}
+		if r.textTransformer != nil {
+			text = r.textTransformer(text)
+		}
+		// Headings are single lines, whatever their source looked like
+		if inHeading(node) {
+			text = joinLines(text)
+		}
+		if r.collapseSpaces {
+			text = collapseSpaces(text)
+		}
+		if r.typographicDashes {
+			text = typographicDashes(text)
+		}
+		if r.headingCase == TitleCase && inHeadingText(node) {
+			text = titleCase(text, isFirstInHeading(node), isLastInHeading(node))
+		}
+		// Blackfriday keeps the alternate text of images as written in the source
+		if r.escapeText && !inImage(node) {
+			text = r.escapeTextNode(node, text)
+			if r.preserveBackslashes {
+				text = preserveBackslashes(text, adjacentChar(node, node.Next, false))
+			}
+			if r.extensions&bf.Strikethrough != 0 {
+				text = escapeTildes(text, adjacentChar(node, node.Prev, true), adjacentChar(node, node.Next, false))
+			}
+		}
+		if r.escapePipes || inTableCell(node) {
+			text = escapePipes(text)
+		}
+		if r.wrapping && !inLink(node) {
+			text = markBreakable(text)
+		}
+		r.writeLines(w, text)
 		return bf.GoToNext
 	case bf.CodeBlock:
-		w.Write([]byte("```"))
-		w.Write(node.CodeBlockData.Info)
-		w.Write([]byte("\n"))
-		w.Write(node.Literal)
-		w.Write([]byte("```\n\n"))
+		code := codeBlockContent(node)
+		if r.codeTabWidth > 0 {
+			code = expandTabs(code, r.codeTabWidth)
+		}
+		if r.trimCodeSpaces {
+			code = trimTrailingSpaces(code)
+		}
+		r.renderCodeBlock(w, node, code)
 		return bf.GoToNext
 	case bf.Softbreak:
-		log.Println("Soft breaks not implemented by renderer")
+		if inHeading(node) || inTableCell(node) {
+			w.Write([]byte(" "))
+			return bf.GoToNext
+		}
+		// Blackfriday keeps soft breaks in the Text literals: both go
+		// through writeLines, which prefixes the next line in a blockquote
+		r.writeLines(w, []byte("\n"))
+		return bf.GoToNext
 	case bf.Hardbreak:
-		w.Write([]byte("  \n"))
+		// Table rows are single lines: GFM breaks cell lines with <br>
+		if inTableCell(node) {
+			if r.stripHTML {
+				r.lose("Hardbreak stripped")
+				w.Write([]byte(" "))
+			} else {
+				w.Write([]byte("<br>"))
+			}
+			return bf.GoToNext
+		}
+		r.writeLines(w, r.hardBreak())
 		return bf.GoToNext
 	case bf.HTMLBlock:
-		fallthrough
+		if r.keepHTML(node.Literal) {
+			r.renderHTMLBlock(w, node)
+		} else {
+			r.lose("HTML block stripped")
+			r.strippedHTML = append(r.strippedHTML, node.Literal)
+		}
+		return bf.GoToNext
 	case bf.HTMLSpan:
-		log.Println("HTML elements not implemented by renderer")
-	case bf.Table:
-		fallthrough
-	case bf.TableCell:
-		fallthrough
-	case bf.TableHead:
-		fallthrough
-	case bf.TableBody:
-		fallthrough
-	case bf.TableRow:
-		log.Println("Markdown tables not implemented by renderer")
+		if isFootnoteBackReference(node) {
+			return bf.GoToNext
+		}
+		if r.keepHTML(node.Literal) {
+			r.writeLines(w, node.Literal)
+		} else {
+			r.lose("HTML span stripped")
+			r.strippedHTML = append(r.strippedHTML, node.Literal)
+		}
+		return bf.GoToNext
+	case bf.Table, bf.TableHead, bf.TableBody, bf.TableRow, bf.TableCell:
+		return r.renderTable(w, node, entering)
 	default:
-		log.Printf("Unknown BlackFriday Node type '%s'\n", node.Type)
+		r.warn(&UnsupportedNodeError{Type: node.Type})
 	}
 
 	return bf.SkipChildren
@@ -182,10 +1296,104 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 
 // RenderHeader satisfies the Renderer interface
 func (r *Renderer) RenderHeader(w io.Writer, ast *bf.Node) {
-	// Nothing required here
+	r.renderHeader(w, ast)
+}
+
+// renderHeader starts the rendering of the given documents, rendered one
+// after the other
+func (r *Renderer) renderHeader(w io.Writer, asts ...*bf.Node) {
+	r.resetReferences()
+	r.warnings = nil
+	r.strippedHTML = nil
+	r.beginOutput(w)
+	w = r.output(w)
+	r.stats = nil
+	if r.analyzeOnly {
+		r.stats = countNodes(asts...)
+		w = ioutil.Discard
+	}
+
+	if len(r.frontMatter) > 0 {
+		w.Write(r.frontMatter)
+		if r.frontMatter[len(r.frontMatter)-1] != '\n' {
+			w.Write([]byte("\n"))
+		}
+		w.Write([]byte("\n"))
+	}
+
+	if r.headerComment != "" {
+		w.Write([]byte("<!-- "))
+		// The comment would end early on a "-->" sequence
+		w.Write([]byte(strings.ReplaceAll(r.headerComment, "-->", "-- >")))
+		w.Write([]byte(" -->\n\n"))
+	}
+
+	if r.tableOfContents || r.headingIDs {
+		placeholder := r.collectHeadings(asts...)
+		if r.tableOfContents && !placeholder {
+			// No placeholder: the table of contents goes on top of the document
+			r.writeTOC(w)
+		}
+	}
+	r.validateAgainst(asts...)
 }
 
 // RenderFooter satisfies the Renderer interface
 func (r *Renderer) RenderFooter(w io.Writer, ast *bf.Node) {
-	// Nothing required here
+	w = r.output(w)
+	if r.analyzeOnly {
+		w = ioutil.Discard
+	}
+	r.writeReferences(w)
+	r.endOutput()
+	r.validate()
+}
+
+// Lossy tells if the last rendered document could not be faithfully
+// represented (stripped HTML, unsupported constructs, etc.)
+func (r *Renderer) Lossy() bool {
+	return len(r.warnings) > 0
+}
+
+// LossyReasons describes what made the last rendered document lossy
+func (r *Renderer) LossyReasons() []string {
+	reasons := make([]string, len(r.warnings))
+	for i, err := range r.warnings {
+		reasons[i] = err.Error()
+	}
+	return reasons
+}
+
+// Warnings returns what made the last rendered document lossy, as errors.
+// Unsupported nodes are reported as *UnsupportedNodeError.
+func (r *Renderer) Warnings() []error {
+	return r.warnings
+}
+
+// StrippedHTML returns the raw HTML blocks and spans (comments included)
+// stripped from the last rendered document, in document order
+func (r *Renderer) StrippedHTML() [][]byte {
+	return r.strippedHTML
+}
+
+// Stats returns the number of nodes of each type found in the last document
+// rendered with WithAnalyzeOnly
+func (r *Renderer) Stats() map[bf.NodeType]int {
+	return r.stats
+}
+
+// countNodes tallies the nodes of asts by type. The rendering skips the
+// children of some nodes (autolinks, wrapped paragraphs, image alternate
+// texts, etc.): they are counted on a walk of their own.
+func countNodes(asts ...*bf.Node) map[bf.NodeType]int {
+	stats := make(map[bf.NodeType]int)
+	for _, ast := range asts {
+		ast.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+			if entering {
+				stats[node.Type]++
+			}
+			return bf.GoToNext
+		})
+	}
+	return stats
 }
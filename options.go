@@ -0,0 +1,533 @@
+package bfmdrenderer
+
+import (
+	"io"
+	"log"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// WithStripComments drops HTML comments instead of emitting them verbatim
+func WithStripComments() Option {
+	return func(r *Renderer) {
+		r.stripComments = true
+	}
+}
+
+// WithFrontMatter preserves a leading front matter block (see StripFrontMatter)
+func WithFrontMatter() Option {
+	return func(r *Renderer) {
+		r.keepFrontMatter = true
+	}
+}
+
+// WithCollapseSpaces reduces runs of intra-line spaces in text to a single space
+func WithCollapseSpaces() Option {
+	return func(r *Renderer) {
+		r.collapseSpaces = true
+	}
+}
+
+// WithLinkRewriter sets a function that rewrites link and image destinations before they are written
+func WithLinkRewriter(rewriter func(dest []byte) []byte) Option {
+	return func(r *Renderer) {
+		r.linkRewriter = rewriter
+	}
+}
+
+// WithTextTransformer sets a function that transforms text before it is written.
+// It is not called for code spans, code blocks or HTML.
+func WithTextTransformer(transformer func(text []byte) []byte) Option {
+	return func(r *Renderer) {
+		r.textTransformer = transformer
+	}
+}
+
+// WithHeadingCase sets how the text of headings is cased (PreserveCase by default)
+func WithHeadingCase(headingCase HeadingCase) Option {
+	return func(r *Renderer) {
+		r.headingCase = headingCase
+	}
+}
+
+// WithEscaping backslash-escapes characters of text that would otherwise be parsed as Markdown
+func WithEscaping() Option {
+	return func(r *Renderer) {
+		r.escapeText = true
+	}
+}
+
+// WithTableOfContents generates a table of contents from the headings. It
+// replaces a paragraph made of "[TOC]" or, if there is none, goes on top of
+// the document.
+func WithTableOfContents() Option {
+	return func(r *Renderer) {
+		r.tableOfContents = true
+	}
+}
+
+// WithHeadingSlugger sets the function creating heading anchors (Slugify by default)
+func WithHeadingSlugger(slugger func(text string) string) Option {
+	return func(r *Renderer) {
+		r.headingSlugger = slugger
+	}
+}
+
+// WithHeadingIDs appends the anchor of each heading as a {#id} suffix
+func WithHeadingIDs() Option {
+	return func(r *Renderer) {
+		r.headingIDs = true
+	}
+}
+
+// WithLazyBlockquotes only prefixes the first line of a paragraph with the
+// blockquote marker, relying on lazy continuation for the following lines.
+// By default, every line of a blockquote is prefixed.
+func WithLazyBlockquotes() Option {
+	return func(r *Renderer) {
+		r.lazyBlockquotes = true
+	}
+}
+
+// WithStripHTML drops raw HTML blocks and spans instead of emitting them verbatim.
+// HTML comments are still kept (see WithStripComments).
+func WithStripHTML() Option {
+	return func(r *Renderer) {
+		r.stripHTML = true
+	}
+}
+
+// WithLogger sets the logger receiving warnings about unsupported constructs
+// (the standard logger by default)
+func WithLogger(logger *log.Logger) Option {
+	return func(r *Renderer) {
+		r.logger = logger
+	}
+}
+
+// WithForceCloseMarkup closes any emphasis, strong or strikethrough span
+// still open at the end of a paragraph or heading, so that unbalanced ASTs
+// cannot leak markup across blocks
+func WithForceCloseMarkup() Option {
+	return func(r *Renderer) {
+		r.forceCloseMarkup = true
+	}
+}
+
+// WithListBaseIndent indents top-level lists (and their nested lists) by n spaces
+func WithListBaseIndent(n int) Option {
+	return func(r *Renderer) {
+		r.listBaseIndent = n
+	}
+}
+
+// WithReferenceLinks renders links as references ([text][label]), with their
+// definitions at the end of the document
+func WithReferenceLinks() Option {
+	return func(r *Renderer) {
+		r.referenceLinks = true
+	}
+}
+
+// WithReferenceImages renders images as references (![alt][label]). Their
+// definitions are shared with those of WithReferenceLinks.
+func WithReferenceImages() Option {
+	return func(r *Renderer) {
+		r.referenceImages = true
+	}
+}
+
+// WithDefinitionOrder sets the order of link reference definitions
+// (DefinitionOrderFirstUse by default)
+func WithDefinitionOrder(order DefinitionOrder) Option {
+	return func(r *Renderer) {
+		r.definitionOrder = order
+	}
+}
+
+// WithSmartUnderscoreEscaping enables escaping (see WithEscaping), but only
+// escapes underscores that could be taken for emphasis delimiters, leaving
+// intraword ones (snake_case) alone
+func WithSmartUnderscoreEscaping() Option {
+	return func(r *Renderer) {
+		r.escapeText = true
+		r.smartUnderscores = true
+	}
+}
+
+// WithListMarkerSpacing sets the number of spaces between a list marker and
+// the item content (1 by default), from 1 to 4: without a space, the marker
+// is mere text, and CommonMark reads content after five spaces or more as
+// indented code
+func WithListMarkerSpacing(n int) Option {
+	return func(r *Renderer) {
+		if n < 1 {
+			n = 1
+		} else if n > 4 {
+			n = 4
+		}
+		r.listMarkerSpacing = n
+	}
+}
+
+// WithWrapWidth wraps paragraphs at the given width. Continuation lines are
+// decorated and indented to stay in their blockquote or list item. Words,
+// code spans and links are never split: those wider than the width overflow.
+func WithWrapWidth(width int) Option {
+	return func(r *Renderer) {
+		r.wrapWidth = width
+	}
+}
+
+// WithSetextHeadings renders level 1 and 2 headings underlined with = and -
+func WithSetextHeadings() Option {
+	return func(r *Renderer) {
+		r.setextHeadings = true
+	}
+}
+
+// WithSetextUnderline sets the width of setext heading underlines
+// (SetextUnderlineMatch by default)
+func WithSetextUnderline(underline SetextUnderline) Option {
+	return func(r *Renderer) {
+		r.setextUnderline = underline
+	}
+}
+
+// WithTightHeadings omits the space between the # run and the heading text
+// (#Title). This is not CommonMark compliant: CommonMark parsers, and
+// Blackfriday with the SpaceHeadings extension, read such lines as paragraphs.
+func WithTightHeadings() Option {
+	return func(r *Renderer) {
+		r.tightHeadings = true
+	}
+}
+
+// WithBulletChar sets the marker of unordered list items (-, * or +).
+// By default, the marker of the source document is kept.
+func WithBulletChar(bullet byte) Option {
+	return func(r *Renderer) {
+		r.bulletChar = bullet
+	}
+}
+
+// WithLintFriendly is a preset producing output that passes the default
+// markdownlint rules: dash bullets (MD004), ATX headings with a space after
+// the # run (MD003, MD018), no trailing whitespace besides two-space hard
+// breaks (MD009), no consecutive blank lines (MD012) and a single final
+// newline (MD047). Fenced code blocks are left untouched.
+// Options given after this one may override the heading and bullet styles.
+func WithLintFriendly() Option {
+	return func(r *Renderer) {
+		r.lintFriendly = true
+		r.bulletChar = '-'
+		r.setextHeadings = false
+		r.tightHeadings = false
+	}
+}
+
+// WithInlineHTMLOutput renders emphasis, strong emphasis and strikethrough as
+// <em>, <strong> and <del> tags instead of Markdown delimiters
+func WithInlineHTMLOutput() Option {
+	return func(r *Renderer) {
+		r.inlineHTML = true
+	}
+}
+
+// WithPaddedTables aligns the columns of tables, padding cells with spaces.
+// Widths are display widths: wide East Asian characters take two columns and
+// combining marks none.
+func WithPaddedTables() Option {
+	return func(r *Renderer) {
+		r.paddedTables = true
+	}
+}
+
+// WithHeaderComment writes an HTML comment on top of the rendered document,
+// such as "generated by X; do not edit". Front matter, when kept, stays
+// first so that it is still recognized as such.
+func WithHeaderComment(comment string) Option {
+	return func(r *Renderer) {
+		r.headerComment = comment
+	}
+}
+
+// WithEscapePipes escapes pipes in all text, not only in table cells, for
+// content meant to be spliced into a table cell later on
+func WithEscapePipes() Option {
+	return func(r *Renderer) {
+		r.escapePipes = true
+	}
+}
+
+// WithAllOnesNumbering numbers every ordered list item 1., at all nesting
+// levels, so that inserting or removing an item does not renumber the others
+func WithAllOnesNumbering() Option {
+	return func(r *Renderer) {
+		r.allOnesNumbering = true
+	}
+}
+
+// WithAnalyzeOnly walks the document without writing anything: nodes are
+// tallied by type, see Stats, and lossy constructs are still reported
+func WithAnalyzeOnly() Option {
+	return func(r *Renderer) {
+		r.analyzeOnly = true
+	}
+}
+
+// WithBlockquotePrefix sets the prefix added to the lines of a blockquote, at
+// each nesting level ("> " by default)
+func WithBlockquotePrefix(prefix []byte) Option {
+	return func(r *Renderer) {
+		r.blockquotePrefix = prefix
+	}
+}
+
+// WithRuleSpacing sets the number of blank lines following a horizontal rule
+// (1 by default)
+func WithRuleSpacing(n int) Option {
+	return func(r *Renderer) {
+		r.ruleSpacing = n
+	}
+}
+
+// WithPlainImageAlt strips emphasis, strikethrough and code span markup from
+// the alternate text of images
+func WithPlainImageAlt() Option {
+	return func(r *Renderer) {
+		r.plainImageAlt = true
+	}
+}
+
+// WithCodeTabWidth expands the tabs of code blocks to spaces, on tab stops
+// every width columns. Code blocks are kept verbatim by default.
+func WithCodeTabWidth(width int) Option {
+	return func(r *Renderer) {
+		r.codeTabWidth = width
+	}
+}
+
+// WithNodeHandler registers a handler consulted before rendering each node,
+// to render node types the renderer does not know (Blackfriday extensions)
+// or to override the rendering of known ones. The handler returns true when
+// it handled the node, false to let the renderer do it.
+func WithNodeHandler(handler func(w io.Writer, node *bf.Node, entering bool) (bf.WalkStatus, bool)) Option {
+	return func(r *Renderer) {
+		r.nodeHandler = handler
+	}
+}
+
+// WithDefinitionSpacing sets the number of blank lines between the
+// term/definition groups of definition lists (1 by default). Beware that
+// Blackfriday reads a term that directly follows a definition as part of
+// that definition: compact lists (0) do not survive a round trip.
+func WithDefinitionSpacing(n int) Option {
+	return func(r *Renderer) {
+		r.definitionSpacing = n
+	}
+}
+
+// WithDropEmptyBlocks skips the paragraphs, headings and list items with no
+// visible content, which transformed trees may hold
+func WithDropEmptyBlocks() Option {
+	return func(r *Renderer) {
+		r.dropEmptyBlocks = true
+	}
+}
+
+// WithMaxOutputBytes caps the size of the output, for untrusted input.
+// Rendering stops, and the document is reported lossy, once n bytes have
+// been written.
+func WithMaxOutputBytes(n int) Option {
+	return func(r *Renderer) {
+		r.maxOutputBytes = n
+	}
+}
+
+// WithGFMAlerts keeps the marker of GFM alerts (a blockquote opening with
+// [!NOTE], [!WARNING], etc.) unescaped, on its own line
+func WithGFMAlerts() Option {
+	return func(r *Renderer) {
+		r.gfmAlerts = true
+	}
+}
+
+// WithDropEmptyImages omits the images with no destination
+func WithDropEmptyImages() Option {
+	return func(r *Renderer) {
+		r.dropEmptyImages = true
+	}
+}
+
+// WithExtensions tells the renderer which Blackfriday extensions the output
+// will be parsed with, so that escaping covers the syntax they add
+// (strikethrough tildes, for instance)
+func WithExtensions(extensions bf.Extensions) Option {
+	return func(r *Renderer) {
+		r.extensions = extensions
+	}
+}
+
+// WithHardBreakStyle sets how hard line breaks are written (HardBreakSpaces
+// by default)
+func WithHardBreakStyle(style HardBreakStyle) Option {
+	return func(r *Renderer) {
+		r.hardBreakStyle = style
+	}
+}
+
+// WithTitleStyle sets how the titles of links and images are delimited
+// (TitleDoubleQuotes by default). CommonMark reads all three styles, but
+// blackfriday does not read parenthesized titles.
+func WithTitleStyle(style TitleStyle) Option {
+	return func(r *Renderer) {
+		r.titleStyle = style
+	}
+}
+
+// WithInternalBuffer renders into an internal buffer, read back with Bytes,
+// instead of the writer given to the renderer
+func WithInternalBuffer() Option {
+	return func(r *Renderer) {
+		r.internalBuffer = true
+	}
+}
+
+// WithOrderedAlignment right-aligns the numbers of ordered lists, so that
+// " 9." and "10." share a column
+func WithOrderedAlignment() Option {
+	return func(r *Renderer) {
+		r.orderedAlignment = true
+	}
+}
+
+// WithNormalizeEmphasis simplifies redundant nesting: an emphasis (or strong
+// emphasis) that is the whole content of another one of the same kind is
+// rendered once
+func WithNormalizeEmphasis() Option {
+	return func(r *Renderer) {
+		r.normalizeEmphasis = true
+	}
+}
+
+// WithTypographicDashes turns "--" into an en dash and "---" into an em dash
+// in text. Code spans and code blocks are left untouched.
+func WithTypographicDashes() Option {
+	return func(r *Renderer) {
+		r.typographicDashes = true
+	}
+}
+
+// WithEmphasisStyle sets the delimiter of emphasis and strong emphasis: '*'
+// (the default) or '_'. Underscores do not work within words, where '*' is
+// used regardless. Blackfriday does not record the delimiter used in the
+// source, nor the position of nodes, so the original style cannot be kept.
+func WithEmphasisStyle(c byte) Option {
+	return func(r *Renderer) {
+		r.emphasisStyle = c
+	}
+}
+
+// WithSimpleListIndent indents nested lists by the width of a bullet and its
+// spacing (two spaces by default), whatever the marker of their parent item.
+// Blackfriday nests them all the same, but CommonMark parsers need the
+// content of "10. " items to be indented by four.
+func WithSimpleListIndent() Option {
+	return func(r *Renderer) {
+		r.simpleListIndent = true
+	}
+}
+
+// WithMinColumnWidth pads the columns of tables to at least width display
+// columns. It applies to padded tables only (see WithPaddedTables).
+func WithMinColumnWidth(width int) Option {
+	return func(r *Renderer) {
+		r.minColumnWidth = width
+	}
+}
+
+// WithSourceLineComments writes an HTML comment, such as <!-- L12 -->, before
+// each top-level block, for debugging. Blackfriday nodes carry no source
+// position: line tells the line a block comes from, if known.
+func WithSourceLineComments(line func(node *bf.Node) (int, bool)) Option {
+	return func(r *Renderer) {
+		r.sourceLine = line
+	}
+}
+
+// WithStreaming writes the output as nodes are visited, never holding back
+// more than a line: padded tables are written unpadded, and WithInternalBuffer
+// is ignored. Reference definitions are still written at the end.
+func WithStreaming() Option {
+	return func(r *Renderer) {
+		r.streaming = true
+	}
+}
+
+// WithPreserveBackslashes leaves the backslashes of text alone when escaping
+// (see WithEscaping), rather than doubling them: only the backslashes followed
+// by punctuation, which would escape it, are escaped.
+func WithPreserveBackslashes() Option {
+	return func(r *Renderer) {
+		r.preserveBackslashes = true
+	}
+}
+
+// WithMergeAdjacentEmphasis merges adjacent spans of the same type, such as
+// two emphasis with no text in between, into a single one
+func WithMergeAdjacentEmphasis() Option {
+	return func(r *Renderer) {
+		r.mergeEmphasis = true
+	}
+}
+
+// WithMinInlineBackticks delimits code spans with at least n backticks (1 by
+// default). Code holding backticks still gets a longer delimiter.
+func WithMinInlineBackticks(n int) Option {
+	return func(r *Renderer) {
+		r.minInlineBackticks = n
+	}
+}
+
+// WithTrimCodeTrailingSpace strips the trailing whitespace of the lines of
+// code blocks, which is seldom significant but shows in diffs
+func WithTrimCodeTrailingSpace() Option {
+	return func(r *Renderer) {
+		r.trimCodeSpaces = true
+	}
+}
+
+// WithFenceLanguageOnly keeps only the first word of the info string of code
+// blocks, the language, rather than the whole info string
+func WithFenceLanguageOnly() Option {
+	return func(r *Renderer) {
+		r.fenceLanguageOnly = true
+	}
+}
+
+// WithHeadingOffset adds n to the level of every heading, to embed the
+// document under an existing section. Levels are kept within 1 to 6.
+func WithHeadingOffset(n int) Option {
+	return func(r *Renderer) {
+		r.headingOffset = n
+	}
+}
+
+// WithMaxHeadingLevel clamps the level of headings, after any offset, to m
+func WithMaxHeadingLevel(m int) Option {
+	return func(r *Renderer) {
+		r.maxHeadingLevel = m
+	}
+}
+
+// WithValidation parses the rendered Markdown back with Blackfriday, using
+// the extensions of WithExtensions (or the common ones), and reports a
+// *ValidationError among the warnings when its structure differs from the
+// rendered tree. The output is parsed twice as much: this is meant for
+// generation pipelines, not for every render.
+func WithValidation() Option {
+	return func(r *Renderer) {
+		r.validation = true
+	}
+}
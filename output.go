@@ -0,0 +1,79 @@
+package bfmdrenderer
+
+import "io"
+
+// budgetWriter writes at most budget bytes to w and drops the rest
+type budgetWriter struct {
+	w       io.Writer
+	budget  int
+	written int
+	// reported tells if the truncation has been reported
+	reported bool
+}
+
+// Write writes what fits in the remaining budget of p
+func (b *budgetWriter) Write(p []byte) (int, error) {
+	if remaining := b.budget - b.written; len(p) > remaining {
+		p = p[:remaining]
+	}
+	n, err := b.w.Write(p)
+	b.written += n
+	return n, err
+}
+
+// exhausted tells if the whole budget has been written
+func (b *budgetWriter) exhausted() bool {
+	return b.written >= b.budget
+}
+
+// beginOutput sets up the writers the output written to w goes through: the
+// copy kept by WithValidation, the output budget of WithMaxOutputBytes and the
+// lint writer of WithLintFriendly.
+// With WithInternalBuffer, the output ends up in the internal buffer rather
+// than in w, unless streaming.
+func (r *Renderer) beginOutput(w io.Writer) {
+	r.root = w
+	r.out = w
+	if r.internalBuffer && !r.streaming {
+		r.buffer.Reset()
+		r.out = &r.buffer
+	}
+	r.validator = nil
+	if r.validation {
+		r.validator = &validator{w: r.out}
+		r.out = r.validator
+	}
+	r.budget = nil
+	r.lint = nil
+	if r.maxOutputBytes > 0 {
+		r.budget = &budgetWriter{w: r.out, budget: r.maxOutputBytes}
+		r.out = r.budget
+	}
+	if r.lintFriendly {
+		r.lint = &lintWriter{w: r.out}
+		r.out = r.lint
+	}
+}
+
+// output returns the writer the rendered Markdown has to be written to.
+// Nodes rendered to an intermediate buffer are not normalized until the
+// buffer itself gets written out.
+func (r *Renderer) output(w io.Writer) io.Writer {
+	if r.out != nil && w == r.root {
+		return r.out
+	}
+	return w
+}
+
+// endOutput flushes the lint writer
+func (r *Renderer) endOutput() {
+	if r.lint != nil {
+		r.lint.flush()
+	}
+	r.root, r.out, r.lint = nil, nil, nil
+}
+
+// Bytes returns the last rendered document, with WithInternalBuffer
+func (r *Renderer) Bytes() []byte {
+	return r.buffer.Bytes()
+}
@@ -0,0 +1,58 @@
+package bfmdrenderer
+
+import (
+	"bytes"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// quotedList is the list state of an item holding a blockquote, set aside
+// while the blockquote is rendered
+type quotedList struct {
+	decoration decoration
+	level      int
+}
+
+// inListItem tells if a block is part of the content of a list item, other
+// than a term or a definition
+func inListItem(node *bf.Node) bool {
+	return node.Parent != nil && node.Parent.Type == bf.Item && !isDefinitionListItem(node.Parent)
+}
+
+// enterItemQuote starts a blockquote within a list item. The item indentation
+// and the quote marker make a single level of decoration, prefixed to every
+// line, and lists within the blockquote are nested from scratch.
+func (r *Renderer) enterItemQuote(node *bf.Node) {
+	prefix := append([]byte(nil), r.nestedListDecoration.bytes...)
+	if node.Prev != nil {
+		prefix = append(prefix, r.itemBlockIndent()...)
+	} else {
+		prefix = append(prefix, bytes.Repeat([]byte(" "), r.markerWidth())...)
+	}
+	r.paragraphDecoration.push(append(prefix, r.blockquotePrefix...)...)
+
+	r.quotedLists = append(r.quotedLists, quotedList{r.nestedListDecoration, r.nestedListLevel})
+	r.nestedListDecoration = decoration{}
+	r.nestedListLevel = 0
+}
+
+// exitItemQuote restores the list state set aside by enterItemQuote
+func (r *Renderer) exitItemQuote() {
+	last := r.quotedLists[len(r.quotedLists)-1]
+	r.quotedLists = r.quotedLists[:len(r.quotedLists)-1]
+	r.nestedListDecoration = last.decoration
+	r.nestedListLevel = last.level
+}
+
+// itemQuoteDepth returns the number of blockquotes a block opens along with
+// the list item they open, or 0: its first line follows the item marker.
+func itemQuoteDepth(node *bf.Node) int {
+	depth := 0
+	for ; node.Prev == nil && node.Parent != nil && node.Parent.Type == bf.BlockQuote; node = node.Parent {
+		depth++
+	}
+	if depth == 0 || node.Prev != nil || !inListItem(node) {
+		return 0
+	}
+	return depth
+}
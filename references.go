@@ -0,0 +1,103 @@
+package bfmdrenderer
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// DefinitionOrder defines the order of link reference definitions
+type DefinitionOrder int
+
+const (
+	// DefinitionOrderFirstUse lists definitions in the order links appear
+	DefinitionOrderFirstUse DefinitionOrder = iota
+	// DefinitionOrderSorted lists definitions alphabetically by label
+	DefinitionOrderSorted
+)
+
+// reference is a link reference definition
+type reference struct {
+	label       string
+	destination []byte
+	title       []byte
+}
+
+// resetReferences forgets the link reference definitions collected so far
+func (r *Renderer) resetReferences() {
+	r.references = r.references[:0]
+	r.referencesByLabel = make(map[string]int)
+	r.referencesByTarget = make(map[string]int)
+}
+
+// referenceLabel returns the label of the reference definition for a link or
+// an image, creating the definition on first use. Labels are made from the
+// link text or the image alt, with a numeric suffix when the same text points
+// to different targets. Links and images share the definitions, whose syntax
+// is the same: a link and an image to the same destination and title get a
+// single one.
+func (r *Renderer) referenceLabel(node *bf.Node) string {
+	if r.referencesByLabel == nil {
+		r.resetReferences()
+	}
+
+	target := string(node.LinkData.Destination) + "\x00" + string(node.LinkData.Title)
+	if i, ok := r.referencesByTarget[target]; ok {
+		return r.references[i].label
+	}
+
+	base := strings.Join(strings.Fields(plainText(node)), " ")
+	if base == "" {
+		base = strconv.Itoa(len(r.references) + 1)
+	}
+	label := base
+	for n := 2; ; n++ {
+		if _, taken := r.referencesByLabel[strings.ToLower(label)]; !taken {
+			break
+		}
+		label = base + " " + strconv.Itoa(n)
+	}
+
+	r.referencesByLabel[strings.ToLower(label)] = len(r.references)
+	r.referencesByTarget[target] = len(r.references)
+	r.references = append(r.references, reference{
+		label:       label,
+		destination: node.LinkData.Destination,
+		title:       node.LinkData.Title,
+	})
+	return label
+}
+
+// writeReferences writes the link reference definitions collected so far
+func (r *Renderer) writeReferences(w io.Writer) {
+	if len(r.references) == 0 {
+		return
+	}
+
+	references := r.references
+	if r.definitionOrder == DefinitionOrderSorted {
+		references = append([]reference(nil), r.references...)
+		sort.SliceStable(references, func(i, j int) bool {
+			return strings.ToLower(references[i].label) < strings.ToLower(references[j].label)
+		})
+	}
+
+	for _, ref := range references {
+		w.Write([]byte("["))
+		w.Write(escapeText([]byte(ref.label)))
+		w.Write([]byte("]: "))
+		// Like inline links, destinations with spaces are angle-bracketed as
+		// CommonMark specifies. Blackfriday itself cannot read them back
+		// from a reference definition.
+		r.writeDestination(w, ref.destination)
+		if len(ref.title) > 0 {
+			w.Write([]byte(" "))
+			r.writeTitle(w, ref.title)
+		}
+		w.Write([]byte("\n"))
+	}
+	w.Write([]byte("\n"))
+}
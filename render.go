@@ -0,0 +1,138 @@
+package bfmdrenderer
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// render walks the subtree rooted at node
+func (r *Renderer) render(w io.Writer, node *bf.Node) {
+	node.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		return r.RenderNode(w, node, entering)
+	})
+}
+
+// findHeading returns the first heading whose text is text
+func findHeading(ast *bf.Node, text string) *bf.Node {
+	var heading *bf.Node
+	ast.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if entering && node.Type == bf.Heading && strings.TrimSpace(plainText(node)) == text {
+			heading = node
+			return bf.Terminate
+		}
+		return bf.GoToNext
+	})
+	return heading
+}
+
+// RenderDocuments renders several documents to w, one after the other, as a
+// single one: reference links share one pool of labels and definitions,
+// written once at the end, and so do heading anchors. Front matter comes from
+// the renderer options, as for a single document.
+func (r *Renderer) RenderDocuments(w io.Writer, asts ...*bf.Node) {
+	if len(asts) == 0 {
+		return
+	}
+	r.renderHeader(w, asts...)
+	for _, ast := range asts {
+		r.render(w, ast)
+	}
+	r.RenderFooter(w, asts[len(asts)-1])
+}
+
+// RenderSection renders the section introduced by the heading whose text is
+// headingText: the heading itself and its following siblings, up to the next
+// heading of the same or a higher level. Subsections are included.
+// It returns nil if there is no such heading.
+func RenderSection(ast *bf.Node, headingText string, options ...Option) []byte {
+	heading := findHeading(ast, headingText)
+	if heading == nil {
+		return nil
+	}
+
+	r := NewRenderer(options...)
+	if r.headingIDs {
+		r.collectHeadings(ast)
+	}
+
+	var buf bytes.Buffer
+	r.beginOutput(&buf)
+	var section []*bf.Node
+	for node := heading; node != nil; node = node.Next {
+		if node != heading && node.Type == bf.Heading && node.Level <= heading.Level {
+			break
+		}
+		section = append(section, node)
+	}
+	r.validateAgainst(section...)
+	for _, node := range section {
+		r.render(&buf, node)
+	}
+	r.RenderFooter(&buf, ast)
+	return buf.Bytes()
+}
+
+// RenderNodeToString renders node and its subtree alone, without front matter
+// or header comment, for tests and snippets. Heading anchors are the ones of
+// the whole document node belongs to, and the definitions of reference links
+// follow the rendered node.
+func RenderNodeToString(r *Renderer, node *bf.Node) string {
+	if r.headingIDs {
+		root := node
+		for root.Parent != nil {
+			root = root.Parent
+		}
+		r.collectHeadings(root)
+	}
+	r.resetReferences()
+	r.warnings = nil
+	r.strippedHTML = nil
+	r.stats = nil
+	if r.analyzeOnly {
+		r.stats = countNodes(node)
+	}
+
+	var buf bytes.Buffer
+	r.beginOutput(&buf)
+	r.validateAgainst(node)
+	r.render(&buf, node)
+	r.RenderFooter(&buf, node)
+	return buf.String()
+}
+
+// parserExtensions returns the extensions to parse Markdown with: those of
+// WithExtensions, or the common ones
+func (r *Renderer) parserExtensions() bf.Extensions {
+	if r.extensions == 0 {
+		return bf.CommonExtensions
+	}
+	return r.extensions
+}
+
+// RenderInline renders a snippet of inline markup, such as a link text or a
+// table cell, without any block decoration or trailing newline. Paragraphs
+// are joined with a space. The snippet is parsed with the extensions of
+// WithExtensions, or the common ones.
+func RenderInline(input []byte, options ...Option) []byte {
+	r := NewRenderer(options...)
+	ast := bf.New(bf.WithExtensions(r.parserExtensions())).Parse(input)
+
+	var buf bytes.Buffer
+	ast.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if !entering || (node.Type != bf.Paragraph && node.Type != bf.Heading) {
+			return bf.GoToNext
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		for child := node.FirstChild; child != nil; child = child.Next {
+			r.render(&buf, child)
+		}
+		r.closeInlines(&buf, 0)
+		return bf.SkipChildren
+	})
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
@@ -0,0 +1,200 @@
+package bfmdrenderer
+
+import (
+	"bytes"
+	"io"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// inTableCell tells if node belongs to a table cell
+func inTableCell(node *bf.Node) bool {
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if parent.Type == bf.TableCell {
+			return true
+		}
+	}
+	return false
+}
+
+// escapePipes backslash-escapes the pipes that would otherwise split a table cell
+func escapePipes(text []byte) []byte {
+	if bytes.IndexByte(text, '|') < 0 {
+		return text
+	}
+	return bytes.ReplaceAll(text, []byte("|"), []byte("\\|"))
+}
+
+// alignmentMarker returns the delimiter row cell matching a column alignment,
+// width characters wide (3 at least)
+func alignmentMarker(align bf.CellAlignFlags, width int) []byte {
+	marker := bytes.Repeat([]byte("-"), width)
+	switch align {
+	case bf.TableAlignmentLeft:
+		marker[0] = ':'
+	case bf.TableAlignmentRight:
+		marker[width-1] = ':'
+	case bf.TableAlignmentCenter:
+		marker[0] = ':'
+		marker[width-1] = ':'
+	}
+	return marker
+}
+
+// writeDelimiterRow writes the row separating the table head from its body
+// (an empty head has no columns to align, hence no delimiter row)
+func (r *Renderer) writeDelimiterRow(w io.Writer, table *bf.Node, head *bf.Node) {
+	if head.FirstChild == nil {
+		return
+	}
+	r.writeBlockPrefix(w, table)
+	w.Write([]byte("|"))
+	for cell := head.FirstChild.FirstChild; cell != nil; cell = cell.Next {
+		w.Write([]byte(" "))
+		w.Write(alignmentMarker(cell.Align, 3))
+		w.Write([]byte(" |"))
+	}
+	w.Write([]byte("\n"))
+}
+
+// endTable writes the blank line following a table. The last block of a
+// blockquote is followed by the blank line ending it.
+func (r *Renderer) endTable(w io.Writer, table *bf.Node) {
+	if table.Next != nil || table.Parent.Type != bf.BlockQuote {
+		r.writeBlankLine(w)
+	}
+}
+
+// padCell writes a cell content padded to width columns, according to the
+// column alignment
+func padCell(w io.Writer, content []byte, align bf.CellAlignFlags, width int) {
+	padding := width - displayWidth(content)
+	left := 0
+	switch align {
+	case bf.TableAlignmentRight:
+		left = padding
+	case bf.TableAlignmentCenter:
+		left = padding / 2
+	}
+	w.Write(bytes.Repeat([]byte(" "), left))
+	w.Write(content)
+	w.Write(bytes.Repeat([]byte(" "), padding-left))
+}
+
+// renderCell renders the content of a table cell on a single line. GFM cells
+// only hold inline content: should a cell hold blocks nonetheless, their
+// content is rendered one after the other, separated by spaces.
+func (r *Renderer) renderCell(cell *bf.Node) []byte {
+	var buf bytes.Buffer
+	for child := cell.FirstChild; child != nil; child = child.Next {
+		if child.Type == bf.Paragraph || child.Type == bf.Heading {
+			if buf.Len() > 0 {
+				buf.WriteByte(' ')
+			}
+			for inline := child.FirstChild; inline != nil; inline = inline.Next {
+				r.render(&buf, inline)
+			}
+			continue
+		}
+		r.render(&buf, child)
+	}
+	return bytes.TrimSpace(bytes.ReplaceAll(buf.Bytes(), []byte("\n"), []byte(" ")))
+}
+
+// renderPaddedTable renders a whole table with its columns aligned. All the
+// rows are rendered first, in document order, so that the width of each column
+// is known upfront. The rows are buffered in local variables: nothing is left
+// behind for the next table, even when the rendering stops mid-table.
+func (r *Renderer) renderPaddedTable(w io.Writer, table *bf.Node) {
+	var rows [][][]byte
+	var aligns []bf.CellAlignFlags
+	var widths []int
+	headRows := 0
+	for section := table.FirstChild; section != nil; section = section.Next {
+		for row := section.FirstChild; row != nil; row = row.Next {
+			var cells [][]byte
+			for cell := row.FirstChild; cell != nil; cell = cell.Next {
+				content := r.renderCell(cell)
+				col := len(cells)
+				if col == len(widths) {
+					// Delimiter rows need three characters: ---, :-: or :--
+					width := 3
+					if r.minColumnWidth > width {
+						width = r.minColumnWidth
+					}
+					widths = append(widths, width)
+					aligns = append(aligns, cell.Align)
+				}
+				if width := displayWidth(content); width > widths[col] {
+					widths[col] = width
+				}
+				cells = append(cells, content)
+			}
+			rows = append(rows, cells)
+			if section.Type == bf.TableHead {
+				headRows++
+			}
+		}
+	}
+
+	for i, cells := range rows {
+		r.writeBlockPrefix(w, table)
+		w.Write([]byte("|"))
+		for col, width := range widths {
+			var content []byte
+			if col < len(cells) {
+				content = cells[col]
+			}
+			w.Write([]byte(" "))
+			padCell(w, content, aligns[col], width)
+			w.Write([]byte(" |"))
+		}
+		w.Write([]byte("\n"))
+
+		if i == headRows-1 {
+			r.writeBlockPrefix(w, table)
+			w.Write([]byte("|"))
+			for col, width := range widths {
+				w.Write([]byte(" "))
+				w.Write(alignmentMarker(aligns[col], width))
+				w.Write([]byte(" |"))
+			}
+			w.Write([]byte("\n"))
+		}
+	}
+	r.endTable(w, table)
+}
+
+// renderTable renders the table nodes, row by row
+func (r *Renderer) renderTable(w io.Writer, node *bf.Node, entering bool) bf.WalkStatus {
+	switch node.Type {
+	case bf.Table:
+		if entering && r.paddedTables && !r.streaming {
+			r.renderPaddedTable(w, node)
+			return bf.SkipChildren
+		}
+		if !entering {
+			r.endTable(w, node)
+		}
+	case bf.TableHead:
+		// Header-only tables have an empty TableBody, or none at all: the
+		// delimiter row and the trailing blank line do not depend on it
+		if !entering {
+			r.writeDelimiterRow(w, node.Parent, node)
+		}
+	case bf.TableRow:
+		if entering {
+			r.writeBlockPrefix(w, node.Parent.Parent)
+			w.Write([]byte("|"))
+		} else {
+			w.Write([]byte("\n"))
+		}
+	case bf.TableCell:
+		if entering {
+			w.Write([]byte(" "))
+		} else {
+			w.Write([]byte(" |"))
+		}
+	}
+	return bf.GoToNext
+}
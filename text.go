@@ -0,0 +1,461 @@
+package bfmdrenderer
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf8"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// HeadingCase defines how the text of headings is cased
+type HeadingCase int
+
+const (
+	// PreserveCase leaves the text of headings untouched
+	PreserveCase HeadingCase = iota
+	// TitleCase capitalizes every word of headings, except small words
+	TitleCase
+)
+
+// smallWords are not capitalized in title case, unless first or last
+var smallWords = map[string]bool{
+	"a": true, "an": true, "and": true, "as": true, "at": true, "but": true,
+	"by": true, "for": true, "from": true, "in": true, "nor": true, "of": true,
+	"on": true, "or": true, "the": true, "to": true, "vs": true, "via": true,
+	"with": true,
+}
+
+// collapseSpaces reduces runs of spaces to a single space, except at the
+// beginning of a line where indentation might be significant
+func collapseSpaces(text []byte) []byte {
+	out := make([]byte, 0, len(text))
+	lineStart := false
+	for i, c := range text {
+		if c == '\n' {
+			lineStart = true
+		} else if c != ' ' {
+			lineStart = false
+		} else if !lineStart && i > 0 && text[i-1] == ' ' {
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// typographicDashes replaces runs of two hyphens with an en dash and runs of
+// three hyphens with an em dash. Longer runs are left untouched.
+func typographicDashes(text []byte) []byte {
+	out := make([]byte, 0, len(text))
+	for i := 0; i < len(text); {
+		if text[i] != '-' {
+			out = append(out, text[i])
+			i++
+			continue
+		}
+		run := 1
+		for i+run < len(text) && text[i+run] == '-' {
+			run++
+		}
+		switch run {
+		case 2:
+			out = append(out, "\u2013"...)
+		case 3:
+			out = append(out, "\u2014"...)
+		default:
+			out = append(out, text[i:i+run]...)
+		}
+		i += run
+	}
+	return out
+}
+
+// escapedChars are the characters that would be interpreted as inline markup
+var escapedChars = [256]bool{
+	'\\': true,
+	'`':  true,
+	'*':  true,
+	'_':  true,
+	'[':  true,
+	']':  true,
+	'<':  true,
+}
+
+// escapeText backslash-escapes characters that would otherwise be interpreted
+// as Markdown. Text nodes never hold actual markup (emphasis, links, etc. are
+// separate nodes), so every such character in text is a literal one.
+func escapeText(text []byte) []byte {
+	out := make([]byte, 0, len(text))
+	for _, c := range text {
+		if escapedChars[c] {
+			out = append(out, '\\')
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// preserveBackslashes undoes the escaping of the backslashes of escaped text
+// that no punctuation character follows: a backslash only escapes ASCII
+// punctuation, so C:\Users or \n read back the same. after is the character
+// rendered after text, which ends with a backslash of its own when Blackfriday
+// splits escaped characters into text nodes. The backslashes ending a line
+// stay escaped.
+func preserveBackslashes(escaped []byte, after byte) []byte {
+	out := make([]byte, 0, len(escaped))
+	for i := 0; i < len(escaped); i++ {
+		c := escaped[i]
+		if c != '\\' || i+1 == len(escaped) {
+			out = append(out, c)
+			continue
+		}
+		// Escaped characters come in pairs: keep them together
+		out = append(out, c)
+		i++
+		next := after
+		if i+1 < len(escaped) {
+			next = escaped[i+1]
+		}
+		// A backslash ending a line would make a hard line break
+		if escaped[i] == '\\' && !isPunctuation(next) && next != '\n' && next != 0 {
+			continue
+		}
+		out = append(out, escaped[i])
+	}
+	return out
+}
+
+// escapeTildes backslash-escapes the runs of tildes that the strikethrough
+// extension would read as delimiters (~~). Single tildes are left alone.
+// before and after are the characters rendered around text: Blackfriday
+// splits escaped characters into text nodes of their own.
+func escapeTildes(text []byte, before, after byte) []byte {
+	if bytes.IndexByte(text, '~') < 0 {
+		return text
+	}
+	out := make([]byte, 0, len(text)+4)
+	for i, c := range text {
+		previous, next := before, after
+		if i > 0 {
+			previous = text[i-1]
+		}
+		if i+1 < len(text) {
+			next = text[i+1]
+		}
+		if c == '~' && (previous == '~' || next == '~') {
+			out = append(out, '\\')
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// isPunctuation tells if c is an ASCII punctuation character
+func isPunctuation(c byte) bool {
+	return c >= '!' && c <= '/' || c >= ':' && c <= '@' || c >= '[' && c <= '`' || c >= '{' && c <= '~'
+}
+
+// isWhitespace tells if c is a whitespace character (0 stands for a line boundary)
+func isWhitespace(c byte) bool {
+	return c == 0 || c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// isDelimiterRun tells if an underscore between before and after could open
+// or close emphasis, following the CommonMark flanking rules
+func isDelimiterRun(before, after byte) bool {
+	leftFlanking := !isWhitespace(after) && (!isPunctuation(after) || isWhitespace(before) || isPunctuation(before))
+	rightFlanking := !isWhitespace(before) && (!isPunctuation(before) || isWhitespace(after) || isPunctuation(after))
+	canOpen := leftFlanking && (!rightFlanking || isPunctuation(before))
+	canClose := rightFlanking && (!leftFlanking || isPunctuation(after))
+	return canOpen || canClose
+}
+
+// escapeTextSmart is escapeText, except that underscores are only escaped
+// when they could be taken for emphasis delimiters. before and after are the
+// characters surrounding text.
+func escapeTextSmart(text []byte, before, after byte) []byte {
+	out := make([]byte, 0, len(text))
+	for i, c := range text {
+		if c == '_' {
+			prev, next := before, after
+			if i > 0 {
+				prev = text[i-1]
+			}
+			if i < len(text)-1 {
+				next = text[i+1]
+			}
+			if isDelimiterRun(prev, next) {
+				out = append(out, '\\')
+			}
+		} else if escapedChars[c] {
+			out = append(out, '\\')
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// adjacentChar returns the character rendered right before (or after) a text
+// node, as far as it can be told: 0 for a block boundary and '*' (an arbitrary
+// punctuation character) for markup.
+func adjacentChar(node *bf.Node, sibling *bf.Node, before bool) byte {
+	if sibling == nil {
+		switch node.Parent.Type {
+		case bf.Paragraph, bf.Heading, bf.TableCell:
+			return 0
+		}
+		return '*'
+	}
+
+	switch sibling.Type {
+	case bf.Text:
+		if len(sibling.Literal) == 0 {
+			if before {
+				return adjacentChar(sibling, sibling.Prev, true)
+			}
+			return adjacentChar(sibling, sibling.Next, false)
+		}
+		if before {
+			return sibling.Literal[len(sibling.Literal)-1]
+		}
+		return sibling.Literal[0]
+	case bf.Softbreak, bf.Hardbreak:
+		return 0
+	}
+	return '*'
+}
+
+// blockMarkerIndex returns the index of the character that makes line start
+// a block (list item, blockquote, heading, thematic break) or underline the
+// previous one (setext heading), or -1
+func blockMarkerIndex(line []byte) int {
+	i := 0
+	for i < len(line) && i < 3 && line[i] == ' ' {
+		i++
+	}
+	if i == len(line) {
+		return -1
+	}
+
+	followedBySpace := i+1 == len(line) || line[i+1] == ' ' || line[i+1] == '\t'
+	switch c := line[i]; {
+	case c == '>' || c == '#':
+		return i
+	case c == '-' && (followedBySpace || line[i+1] == '-'):
+		return i
+	case c == '+' && followedBySpace:
+		return i
+	case c == '=' && setextUnderline(line[i:]):
+		return i
+	case c >= '0' && c <= '9':
+		j := i
+		for j < len(line) && j-i < 9 && line[j] >= '0' && line[j] <= '9' {
+			j++
+		}
+		if j < len(line) && (line[j] == '.' || line[j] == ')') && (j+1 == len(line) || line[j+1] == ' ' || line[j+1] == '\t') {
+			return j
+		}
+	}
+	return -1
+}
+
+// setextUnderline tells if line, up to its end or a newline, is made of =
+// only, trailing spaces aside
+func setextUnderline(line []byte) bool {
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	return len(bytes.Trim(bytes.TrimRight(line, " \t"), "=")) == 0
+}
+
+// blockLine returns what precedes a text node on its line of the paragraph,
+// and whether that line is the first one, or false if the text node is not in
+// a paragraph or other markup precedes it on that line. Blackfriday splits
+// text at escaped characters: the line may start in a previous text node, or
+// after a line break.
+func blockLine(node *bf.Node) (head []byte, first bool, ok bool) {
+	if node.Parent == nil || node.Parent.Type != bf.Paragraph {
+		return nil, false, false
+	}
+
+	for prev := node.Prev; prev != nil; prev = prev.Prev {
+		switch prev.Type {
+		case bf.Softbreak, bf.Hardbreak:
+			return head, false, true
+		case bf.Text:
+			if i := bytes.LastIndexByte(prev.Literal, '\n'); i >= 0 {
+				return append(append([]byte(nil), prev.Literal[i+1:]...), head...), false, true
+			}
+			head = append(append([]byte(nil), prev.Literal...), head...)
+		default:
+			return nil, false, false
+		}
+	}
+	return head, true, true
+}
+
+// inImage tells if node is part of the alternate text of an image
+func inImage(node *bf.Node) bool {
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if parent.Type == bf.Image {
+			return true
+		}
+	}
+	return false
+}
+
+// taskCheckbox returns the task list checkbox ("[ ] ", "[x] ") that begins
+// text, when node opens a list item, ordered or not. Blackfriday keeps
+// checkboxes as plain text.
+func taskCheckbox(node *bf.Node, text []byte) []byte {
+	paragraph := node.Parent
+	if node.Prev != nil || paragraph == nil || paragraph.Type != bf.Paragraph || paragraph.Prev != nil {
+		return nil
+	}
+	if item := paragraph.Parent; item == nil || item.Type != bf.Item || isDefinitionListItem(item) {
+		return nil
+	}
+	if len(text) < 4 || text[0] != '[' || text[2] != ']' || text[3] != ' ' {
+		return nil
+	}
+	if text[1] != ' ' && text[1] != 'x' && text[1] != 'X' {
+		return nil
+	}
+	return text[:4]
+}
+
+// isAlphanumeric tells if c is an ASCII letter or digit
+func isAlphanumeric(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// stripInlineMarkup removes the emphasis, strikethrough and code span
+// delimiters of text. Escaped characters are kept, and so are underscores
+// within words (snake_case).
+func stripInlineMarkup(text []byte) []byte {
+	out := make([]byte, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '\\':
+			out = append(out, c)
+			if i+1 < len(text) {
+				i++
+				out = append(out, text[i])
+			}
+		case '*', '~', '`':
+		case '_':
+			if i > 0 && i+1 < len(text) && isAlphanumeric(text[i-1]) && isAlphanumeric(text[i+1]) {
+				out = append(out, c)
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// plainAlt returns the alternate text of an image without inline markup.
+// Blackfriday keeps it as written in the source, in a single text node, but
+// hand-built trees may hold emphasis or code nodes.
+func plainAlt(image *bf.Node) []byte {
+	var alt []byte
+	image.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		switch {
+		case !entering:
+		case node.Type == bf.Text:
+			alt = append(alt, stripInlineMarkup(node.Literal)...)
+		case node.Type == bf.Code:
+			alt = append(alt, escapeText(node.Literal)...)
+		}
+		return bf.GoToNext
+	})
+	return alt
+}
+
+// inHeading tells if node belongs to a heading, links and images included
+func inHeading(node *bf.Node) bool {
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if parent.Type == bf.Heading {
+			return true
+		}
+	}
+	return false
+}
+
+// joinLines replaces the line breaks of text, and the blanks around them, by
+// single spaces
+func joinLines(text []byte) []byte {
+	if bytes.IndexByte(text, '\n') < 0 {
+		return text
+	}
+	lines := bytes.Split(text, []byte("\n"))
+	for i := range lines {
+		if i > 0 {
+			lines[i] = bytes.TrimLeft(lines[i], " \t")
+		}
+		if i < len(lines)-1 {
+			lines[i] = bytes.TrimRight(lines[i], " \t")
+		}
+	}
+	return bytes.Join(lines, []byte(" "))
+}
+
+// inHeadingText tells if a text node belongs to a heading, outside of any link or image
+func inHeadingText(node *bf.Node) bool {
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		switch parent.Type {
+		case bf.Heading:
+			return true
+		case bf.Link, bf.Image:
+			return false
+		}
+	}
+	return false
+}
+
+// isFirstInHeading tells if no content precedes node in its heading
+func isFirstInHeading(node *bf.Node) bool {
+	for ; node.Type != bf.Heading; node = node.Parent {
+		if node.Prev != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// isLastInHeading tells if no content follows node in its heading
+func isLastInHeading(node *bf.Node) bool {
+	for ; node.Type != bf.Heading; node = node.Parent {
+		if node.Next != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// titleCase capitalizes each word of text except small words. The first and
+// last words are always capitalized when first (resp. last) is set. Words that
+// already contain capitals (acronyms, brand names) are left untouched.
+func titleCase(text []byte, first bool, last bool) []byte {
+	words := bytes.SplitAfter(text, []byte(" "))
+	out := make([]byte, 0, len(text))
+	for i, word := range words {
+		trimmed := bytes.TrimRight(word, " ")
+		lower := string(bytes.ToLower(trimmed))
+		if smallWords[lower] && !(first && i == 0) && !(last && i == len(words)-1) {
+			out = append(out, lower...)
+			out = append(out, word[len(trimmed):]...)
+			continue
+		}
+
+		c, size := utf8.DecodeRune(word)
+		if size > 0 && unicode.IsLower(c) && lower == string(trimmed) {
+			out = append(out, string(unicode.ToUpper(c))...)
+			out = append(out, word[size:]...)
+		} else {
+			out = append(out, word...)
+		}
+	}
+	return out
+}
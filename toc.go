@@ -0,0 +1,128 @@
+package bfmdrenderer
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// tocPlaceholder is the paragraph replaced by the table of contents
+var tocPlaceholder = []byte("[TOC]")
+
+// tocEntry is a heading, as listed in the table of contents
+type tocEntry struct {
+	level  int
+	text   string
+	anchor string
+}
+
+// plainText returns the textual content of node, without any markup
+func plainText(node *bf.Node) string {
+	var text strings.Builder
+	node.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if entering && (node.Type == bf.Text || node.Type == bf.Code) {
+			text.Write(node.Literal)
+		}
+		return bf.GoToNext
+	})
+	return text.String()
+}
+
+// Slugify creates a GitHub-style anchor from a heading text: lower case,
+// spaces replaced by hyphens and punctuation stripped.
+func Slugify(text string) string {
+	var slug strings.Builder
+	for _, c := range strings.ToLower(text) {
+		if c == ' ' {
+			slug.WriteRune('-')
+		} else if c == '-' || c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c) {
+			slug.WriteRune(c)
+		}
+	}
+	return slug.String()
+}
+
+// isTOCPlaceholder tells if node is the paragraph to replace with the table of contents
+func isTOCPlaceholder(node *bf.Node) bool {
+	return node.Type == bf.Paragraph && node.FirstChild != nil && node.FirstChild == node.LastChild &&
+		node.FirstChild.Type == bf.Text && bytes.Equal(bytes.TrimSpace(node.FirstChild.Literal), tocPlaceholder)
+}
+
+// collectHeadings computes the anchor of every heading and tells whether the
+// document has a table of contents placeholder. Generated anchors that
+// collide are disambiguated with a numeric suffix.
+func (r *Renderer) collectHeadings(asts ...*bf.Node) bool {
+	r.tocEntries = r.tocEntries[:0]
+	r.headingAnchors = make(map[*bf.Node]string)
+	slugger := r.headingSlugger
+	if slugger == nil {
+		slugger = Slugify
+	}
+
+	used := make(map[string]int)
+	placeholder := false
+	visit := func(node *bf.Node, entering bool) bf.WalkStatus {
+		if !entering {
+			return bf.GoToNext
+		}
+		if isTOCPlaceholder(node) {
+			placeholder = true
+			return bf.SkipChildren
+		}
+		if node.Type == bf.Heading {
+			text := plainText(node)
+			anchor := node.HeadingID
+			if anchor == "" {
+				anchor = slugger(text)
+				if n, ok := used[anchor]; ok {
+					for ok {
+						n++
+						_, ok = used[anchor+"-"+strconv.Itoa(n)]
+					}
+					used[anchor] = n
+					anchor += "-" + strconv.Itoa(n)
+				}
+			}
+			used[anchor] = 0
+			r.headingAnchors[node] = anchor
+			r.tocEntries = append(r.tocEntries, tocEntry{level: r.headingLevel(node), text: text, anchor: anchor})
+			return bf.SkipChildren
+		}
+		return bf.GoToNext
+	}
+	for _, ast := range asts {
+		ast.Walk(visit)
+	}
+	return placeholder
+}
+
+// writeTOC writes the table of contents as a nested bullet list
+func (r *Renderer) writeTOC(w io.Writer) {
+	if len(r.tocEntries) == 0 {
+		return
+	}
+
+	minLevel := r.tocEntries[0].level
+	for _, entry := range r.tocEntries {
+		if entry.level < minLevel {
+			minLevel = entry.level
+		}
+	}
+
+	for _, entry := range r.tocEntries {
+		w.Write(r.paragraphDecoration.bytes)
+		for i := minLevel; i < entry.level; i++ {
+			w.Write([]byte("  "))
+		}
+		w.Write([]byte("- ["))
+		w.Write(escapeText([]byte(entry.text)))
+		w.Write([]byte("](#"))
+		w.Write([]byte(entry.anchor))
+		w.Write([]byte(")\n"))
+	}
+	w.Write([]byte("\n"))
+}
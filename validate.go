@@ -0,0 +1,146 @@
+package bfmdrenderer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// sourceLineComment matches the comments written by WithSourceLineComments
+var sourceLineComment = regexp.MustCompile(`^<!-- L[0-9]+ -->\s*$`)
+
+// ValidationError reports that the rendered Markdown, parsed back with
+// Blackfriday, does not have the structure of the rendered tree. Expected and
+// Actual are the node types where the trees diverge, "" past the last node.
+type ValidationError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("output parses back as '%s' where '%s' was rendered", e.Actual, e.Expected)
+}
+
+// validator keeps a copy of the output for WithValidation, from start on:
+// front matter, header comment and table of contents are not part of the
+// rendered tree.
+type validator struct {
+	w      io.Writer
+	output bytes.Buffer
+	start  int
+	roots  []*bf.Node
+}
+
+// Write copies p and writes it to the underlying writer
+func (v *validator) Write(p []byte) (int, error) {
+	v.output.Write(p)
+	return v.w.Write(p)
+}
+
+// validateAgainst sets the nodes the output is compared to, starting now
+func (r *Renderer) validateAgainst(roots ...*bf.Node) {
+	if r.validator == nil {
+		return
+	}
+	r.validator.start = r.validator.output.Len()
+	r.validator.roots = roots
+}
+
+// validate parses the output back and reports the first divergence with the
+// rendered tree, if any
+func (r *Renderer) validate() {
+	v := r.validator
+	r.validator = nil
+	if v == nil || r.analyzeOnly {
+		return
+	}
+
+	extensions := r.parserExtensions()
+	ast := bf.New(bf.WithExtensions(extensions)).Parse(v.output.Bytes()[v.start:])
+
+	// The table of contents replaces its placeholder: the placeholder is
+	// expected to parse back as the generated list
+	var toc []string
+	if r.tableOfContents {
+		var buf bytes.Buffer
+		r.writeTOC(&buf)
+		for child := bf.New(bf.WithExtensions(extensions)).Parse(buf.Bytes()).FirstChild; child != nil; child = child.Next {
+			toc = appendStructure(toc, child, nil)
+		}
+	}
+	placeholder := func(node *bf.Node) ([]string, bool) {
+		if r.tableOfContents && isTOCPlaceholder(node) {
+			return toc, true
+		}
+		return nil, false
+	}
+
+	var expected []string
+	for _, root := range v.roots {
+		if root.Type == bf.Document {
+			for child := root.FirstChild; child != nil; child = child.Next {
+				expected = appendStructure(expected, child, placeholder)
+			}
+		} else {
+			expected = appendStructure(expected, root, placeholder)
+		}
+	}
+	var actual []string
+	for child := ast.FirstChild; child != nil; child = child.Next {
+		actual = appendStructure(actual, child, r.addedNode)
+	}
+
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		var want, got string
+		if i < len(expected) {
+			want = expected[i]
+		}
+		if i < len(actual) {
+			got = actual[i]
+		}
+		if want != got {
+			r.warn(&ValidationError{Expected: want, Actual: got})
+			return
+		}
+	}
+}
+
+// addedNode tells if node, parsed back from the output, was added by the
+// renderer rather than rendered from the tree: it has no structure of its own
+func (r *Renderer) addedNode(node *bf.Node) ([]string, bool) {
+	return nil, r.sourceLine != nil && node.Type == bf.HTMLBlock && sourceLineComment.Match(node.Literal)
+}
+
+// appendStructure appends the node types of the subtree rooted at node, in
+// walk order, each container being closed by ")". Consecutive text nodes are
+// counted as one: escaped characters get a text node of their own. When
+// replace returns true for a node, its subtree is replaced by the given
+// structure.
+func appendStructure(structure []string, node *bf.Node, replace func(node *bf.Node) ([]string, bool)) []string {
+	node.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if entering && replace != nil {
+			if replacement, ok := replace(node); ok {
+				structure = append(structure, replacement...)
+				return bf.SkipChildren
+			}
+		}
+		if !entering {
+			structure = append(structure, ")")
+			return bf.GoToNext
+		}
+		name := strconv.Itoa(int(node.Type))
+		if knownNodeType(node.Type) {
+			name = node.Type.String()
+		}
+		if node.Type == bf.Text && len(structure) > 0 && structure[len(structure)-1] == name {
+			return bf.GoToNext
+		}
+		structure = append(structure, name)
+		return bf.GoToNext
+	})
+	return structure
+}
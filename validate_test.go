@@ -0,0 +1,35 @@
+package bfmdrenderer
+
+import (
+	"testing"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+func TestValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		options []Option
+		valid   bool
+	}{
+		{"clean", "# Title\n\nSome *text*.\n", nil, true},
+		{"stripped HTML", "Text\n\n<div>\nblock\n</div>\n", []Option{WithStripHTML()}, false},
+		{"TOC placeholder", "# A\n\n[TOC]\n\n## B\n\ntext\n", []Option{WithTableOfContents()}, true},
+	}
+	for _, test := range tests {
+		r := NewRenderer(append(test.options, WithValidation())...)
+		bf.Run([]byte(test.input), bf.WithRenderer(r))
+		var invalid []error
+		for _, err := range r.Warnings() {
+			if _, ok := err.(*ValidationError); ok {
+				invalid = append(invalid, err)
+			}
+		}
+		if test.valid && len(invalid) > 0 {
+			t.Errorf("%s: unexpected validation error: %v", test.name, invalid)
+		} else if !test.valid && len(invalid) == 0 {
+			t.Errorf("%s: expected a validation error", test.name)
+		}
+	}
+}
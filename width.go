@@ -0,0 +1,53 @@
+package bfmdrenderer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// wideRanges are the East Asian Wide and Fullwidth code points, which take
+// two columns in a monospace font
+var wideRanges = []struct{ lo, hi rune }{
+	{0x1100, 0x115F},   // Hangul Jamo
+	{0x2E80, 0x303E},   // CJK radicals, punctuation
+	{0x3041, 0x33FF},   // Kana, CJK compatibility
+	{0x3400, 0x4DBF},   // CJK extension A
+	{0x4E00, 0x9FFF},   // CJK unified ideographs
+	{0xA000, 0xA4CF},   // Yi
+	{0xAC00, 0xD7A3},   // Hangul syllables
+	{0xF900, 0xFAFF},   // CJK compatibility ideographs
+	{0xFE30, 0xFE4F},   // CJK compatibility forms
+	{0xFF00, 0xFF60},   // Fullwidth forms
+	{0xFFE0, 0xFFE6},   // Fullwidth signs
+	{0x1F300, 0x1F64F}, // Pictographs, emoticons
+	{0x1F900, 0x1F9FF}, // Supplemental pictographs
+	{0x20000, 0x2FFFD}, // CJK extensions B and later
+	{0x30000, 0x3FFFD},
+}
+
+// runeWidth returns the number of columns c takes in a monospace font
+func runeWidth(c rune) int {
+	if unicode.In(c, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	for _, wide := range wideRanges {
+		if c < wide.lo {
+			break
+		}
+		if c <= wide.hi {
+			return 2
+		}
+	}
+	return 1
+}
+
+// displayWidth returns the number of columns text takes in a monospace font
+func displayWidth(text []byte) int {
+	width := 0
+	for len(text) > 0 {
+		c, size := utf8.DecodeRune(text)
+		width += runeWidth(c)
+		text = text[size:]
+	}
+	return width
+}
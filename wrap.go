@@ -0,0 +1,126 @@
+package bfmdrenderer
+
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// wrapSpace marks, while a paragraph is being wrapped, the spaces where a
+// line can be broken
+const wrapSpace = '\x00'
+
+// inLink tells if node is part of the text of a link or an image
+func inLink(node *bf.Node) bool {
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if parent.Type == bf.Link || parent.Type == bf.Image {
+			return true
+		}
+	}
+	return false
+}
+
+// markBreakable replaces the spaces and line feeds of text with wrapSpace
+func markBreakable(text []byte) []byte {
+	out := make([]byte, len(text))
+	for i, c := range text {
+		if c == ' ' || c == '\n' {
+			c = wrapSpace
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// startsBlock tells if a word would start a block (list, quote, heading,
+// etc.) when found at the beginning of a line
+func startsBlock(word []byte) bool {
+	if len(word) == 0 {
+		return false
+	}
+	switch word[0] {
+	case '-', '+', '*', '>', '#', '=', '|':
+		return true
+	}
+	i := 0
+	for i < len(word) && word[i] >= '0' && word[i] <= '9' {
+		i++
+	}
+	return i > 0 && i == len(word)-1 && (word[i] == '.' || word[i] == ')')
+}
+
+// continuationPrefix returns the decoration of the lines following the
+// first one of a paragraph, which aligns them under its first line. In the
+// first paragraph of an item, they are aligned on the item content or, with
+// WithSimpleListIndent, indented like a nested list.
+func (r *Renderer) continuationPrefix(node *bf.Node) []byte {
+	prefix := append([]byte(nil), r.paragraphDecoration.bytes...)
+	if node.Parent.Type == bf.Item {
+		prefix = append(prefix, r.nestedListDecoration.bytes...)
+		switch {
+		case isDefinition(node.Parent):
+			prefix = append(prefix, definitionIndent...)
+		case node.Prev != nil:
+			prefix = append(prefix, r.itemBlockIndent()...)
+		case r.simpleListIndent && r.markerWidth() > 0:
+			prefix = append(prefix, bytes.Repeat([]byte(" "), 1+r.listMarkerSpacing)...)
+		default:
+			prefix = append(prefix, bytes.Repeat([]byte(" "), r.markerWidth())...)
+		}
+	}
+	return prefix
+}
+
+// renderWrapped renders the content of a paragraph, filling lines up to the
+// wrap width. Lines are only broken at spaces of text: code spans, links and
+// HTML are never split, even if that makes a line overflow. A word wider than
+// the wrap width (a long URL) goes on a line of its own, which overflows, and
+// the following words start a new line.
+func (r *Renderer) renderWrapped(w io.Writer, node *bf.Node) {
+	var buf bytes.Buffer
+	r.wrapping = true
+	for child := node.FirstChild; child != nil; child = child.Next {
+		r.render(&buf, child)
+	}
+	r.wrapping = false
+
+	prefix := r.continuationPrefix(node)
+	column := utf8.RuneCount(prefix)
+	lineStart := true
+	for _, word := range bytes.Split(buf.Bytes(), []byte{wrapSpace}) {
+		if len(word) == 0 {
+			continue
+		}
+
+		width := utf8.RuneCount(word)
+		if i := bytes.IndexByte(word, '\n'); i >= 0 {
+			// Only consider what comes before a hard break
+			width = utf8.RuneCount(word[:i])
+		}
+		if !lineStart && column+1+width > r.wrapWidth && !startsBlock(word) {
+			w.Write([]byte("\n"))
+			w.Write(prefix)
+			column = utf8.RuneCount(prefix)
+		} else if !lineStart {
+			w.Write([]byte(" "))
+			column++
+		}
+
+		// Hard breaks end the line
+		for {
+			i := bytes.IndexByte(word, '\n')
+			if i < 0 {
+				break
+			}
+			w.Write(word[:i+1])
+			w.Write(prefix)
+			word = word[i+1:]
+			column = utf8.RuneCount(prefix)
+		}
+		w.Write(word)
+		column += utf8.RuneCount(word)
+		lineStart = len(word) == 0
+	}
+}